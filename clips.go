@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/algo-boyz/snowgirl/pkg/audio"
+	"github.com/algo-boyz/snowgirl/pkg/hotword"
+)
+
+// ClipConfig records the audio around every detection to Dir, an empty Dir records nothing.
+// PreRoll is kept before the end of the detected window and PostRoll recorded after it
+type ClipConfig struct {
+	Dir               string
+	PreRoll, PostRoll time.Duration
+}
+
+// clipMeta is written next to every clip to link it to its detection
+type clipMeta struct {
+	Wakeword   string    `json:"wakeword"`
+	Confidence float32   `json:"confidence"`
+	Time       time.Time `json:"time"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	SampleRate int       `json:"sample_rate"`
+}
+
+// clipPath names the clip of a detection after its wakeword and time
+func (c ClipConfig) clipPath(d hotword.Detection) string {
+	var name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' {
+			return r
+		}
+		return '_'
+	}, d.Wakeword)
+	return filepath.Join(c.Dir, fmt.Sprintf("%s_%s.wav", name, d.Time.Format("20060102T150405.000")))
+}
+
+// recordClip waits for the post-roll of a detection at the stream position end to be
+// captured and saves it, nothing is saved when the stream closes first
+func (s *SnowGirl) recordClip(d hotword.Detection, end int64) {
+	var cfg = s.cfg.Clips
+	clip, ok := <-s.stream.Clip(end, float32(cfg.PreRoll.Seconds()), float32(cfg.PostRoll.Seconds()))
+	if !ok {
+		return
+	}
+	if err := saveClip(d, clip); err != nil {
+		s.errors.publish(fmt.Errorf("failed to save clip of %s: %w", d.Wakeword, err))
+	}
+}
+
+// saveClip writes the clip to the detection's Clip path and its metadata to a .json next to it
+func saveClip(d hotword.Detection, clip audio.Frame) error {
+	if err := os.MkdirAll(filepath.Dir(d.Clip), 0o755); err != nil {
+		return err
+	}
+	var pcm = &audio.PCM{Samples: clip.Samples, SampleRate: audio.SampleRate, Channels: 1}
+	if err := audio.SaveWAV(d.Clip, pcm); err != nil {
+		return err
+	}
+	meta, err := json.MarshalIndent(clipMeta{
+		Wakeword:   d.Wakeword,
+		Confidence: d.Confidence,
+		Time:       d.Time,
+		Start:      clip.Start(),
+		End:        clip.Time,
+		SampleRate: pcm.SampleRate,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(strings.TrimSuffix(d.Clip, ".wav")+".json", meta, 0o644)
+}
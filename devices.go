@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/algo-boyz/snowgirl/pkg/mic"
+)
+
+// devices lists the input devices that -device selects from, * marks the default
+func devices(args []string) error {
+	var cmd = flag.NewFlagSet("devices", flag.ExitOnError)
+	if err := cmd.Parse(args); err != nil {
+		return err
+	}
+	inputs, err := mic.InputDevices()
+	if err != nil {
+		return err
+	}
+	var w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INDEX\tNAME\tHOST API\tCHANNELS\tDEFAULT RATE")
+	for _, d := range inputs {
+		var index = fmt.Sprint(d.Index)
+		if d.Default {
+			index += "*"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%g\n", index, d.Name, d.HostAPI, d.Channels, d.DefaultSampleRate)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/algo-boyz/snowgirl/pkg/hotword"
+	"github.com/algo-boyz/snowgirl/pkg/state"
+)
+
+// enroll creates a reference embeddings file from 4-10 local recordings of a phrase
+//
+//	snowgirl enroll -out model/hotword/snowgirl_ref.json clip1.wav clip2.wav clip3.wav clip4.wav
+func enroll(ctx state.Context, args []string) error {
+	var (
+		cmd     = flag.NewFlagSet("enroll", flag.ExitOnError)
+		outPath = cmd.String("out", "", "reference embeddings .json output path")
+		name    = cmd.String("name", "", "wakeword name, defaults to the -out file name")
+		suggest = cmd.Float64("threshold", float64(hotword.DefaultThreshold), "suggested detection threshold")
+	)
+	if err := cmd.Parse(args); err != nil {
+		return err
+	}
+	if *outPath == "" {
+		return fmt.Errorf("enroll: -out path is required")
+	}
+	if *name == "" {
+		*name = hotword.WakewordName(*outPath)
+	}
+	var clips = make([][]float32, cmd.NArg())
+	for i, clipPath := range cmd.Args() {
+		clip, err := loadAudio(clipPath)
+		if err != nil {
+			return fmt.Errorf("enroll: %s: %w", clipPath, err)
+		}
+		clips[i] = clip
+	}
+	model, err := hotword.NewModel(ctx, DefaultConfig().OnnxPath, hotwordNetPath, nil)
+	if err != nil {
+		return err
+	}
+	ref, err := hotword.Enroll(model, hotword.DefaultLogMelSpectrogram(), *name, float32(*suggest), clips)
+	if err != nil {
+		return fmt.Errorf("enroll: %w", err)
+	}
+	if err = hotword.SaveReference(*outPath, ref); err != nil {
+		return err
+	}
+	fmt.Printf("enrolled %s from %d clips\n", ref.Wakeword, len(clips))
+	return nil
+}
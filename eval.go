@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/algo-boyz/snowgirl/pkg/audio"
+	"github.com/algo-boyz/snowgirl/pkg/hotword"
+	"github.com/algo-boyz/snowgirl/pkg/state"
+	"go.uber.org/multierr"
+)
+
+// evalReport is written as json so accuracy can be tracked across model and embedding changes
+type evalReport struct {
+	Model       string               `json:"model"`
+	ModelSHA256 string               `json:"model_sha256"`
+	Created     time.Time            `json:"created"`
+	Wakewords   []hotword.Evaluation `json:"wakewords"`
+}
+
+// clip is a labelled recording scored window by window
+type clip struct {
+	label    string
+	duration time.Duration
+	scores   [][]float32 // per wakeword
+}
+
+// eval scores labelled clips against every wakeword reference, clips in <dir>/<wakeword>
+// are positives for that wakeword and negatives for the others, clips in <dir>/negative
+// are negatives for all of them
+//
+//	snowgirl -embedding model/hotword/computer_ref.json eval -dir testdata/clips
+func eval(ctx state.Context, args []string) (err error) {
+	var (
+		cmd          = flag.NewFlagSet("eval", flag.ExitOnError)
+		dir          = cmd.String("dir", "", "directory of labelled clips")
+		outPath      = cmd.String("out", "-", "json report path, - for stdout")
+		maxFAPerHour = cmd.Float64("max-fa-per-hour", 1, "false accepts per hour allowed for the recommended threshold")
+	)
+	if err = cmd.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return fmt.Errorf("eval: -dir is required")
+	}
+	var cfg = config()
+	model, detector, err := newDetector(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	clips, err := scoreClips(model, detector.Wakewords, *dir)
+	if err != nil {
+		return fmt.Errorf("eval: %w", err)
+	}
+	var report = evalReport{
+		Model:       filepath.Base(cfg.HotwordNetPath),
+		ModelSHA256: model.Checksum(),
+		Created:     time.Now().UTC(),
+	}
+	var thresholds = hotword.Thresholds(0.5, 0.99, 0.01)
+	for i, w := range detector.Wakewords {
+		var trials = make([]hotword.Trial, len(clips))
+		for j, c := range clips {
+			trials[j] = hotword.Trial{
+				Positive: c.label == w.Name,
+				Scores:   c.scores[i],
+				Duration: c.duration,
+			}
+		}
+		evaluation := hotword.Evaluate(w.Name, trials, thresholds, *maxFAPerHour)
+		evaluation.Reference = cfg.Wakewords[i].EmbedPath
+		report.Wakewords = append(report.Wakewords, evaluation)
+	}
+	var out io.Writer = os.Stdout
+	if *outPath != "-" {
+		var f *os.File
+		if f, err = os.Create(*outPath); err != nil {
+			return fmt.Errorf("eval: %w", err)
+		}
+		defer func() {
+			err = multierr.Combine(err, f.Close())
+		}()
+		out = f
+	}
+	var enc = json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// scoreClips runs every clip below dir through the model once per window and scores
+// the output against every wakeword, the label of a clip is its parent directory
+func scoreClips(model *hotword.Model, wakewords []*hotword.Wakeword, dir string) (clips []clip, err error) {
+	var lms = hotword.DefaultLogMelSpectrogram()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		paths, err := filepath.Glob(filepath.Join(dir, entry.Name(), "*"))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			pcm, err := loadAudio(path)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			var c = clip{
+				label:    entry.Name(),
+				duration: time.Duration(audio.Seconds(len(pcm)) * float64(time.Second)),
+				scores:   make([][]float32, len(wakewords)),
+			}
+			err = audio.SlidingWindows(pcm, windowLengthSecs, slidingWindowSecs, func(_ int, window []float32) error {
+				normalized, err := lms.AudioToVector(window)
+				if err != nil {
+					return fmt.Errorf("logMelSpec.AudioToVector: %w", err)
+				}
+				output, err := model.ProcessFrame(normalized)
+				if err != nil {
+					return fmt.Errorf("model.ProcessFrame: %w", err)
+				}
+				for i, w := range wakewords {
+					c.scores[i] = append(c.scores[i], w.Score(output))
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			clips = append(clips, c)
+		}
+	}
+	return clips, nil
+}
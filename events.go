@@ -0,0 +1,128 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/algo-boyz/snowgirl/pkg/hotword"
+	"github.com/algo-boyz/snowgirl/pkg/vad"
+)
+
+// broker fans out events to subscribed channels and registered callbacks
+type broker[T any] struct {
+	mu          sync.RWMutex
+	subscribers []chan T
+	handlers    []func(T)
+}
+
+func (b *broker[T]) subscribe() <-chan T {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var ch = make(chan T, 10) // Buffered channel to prevent blocking
+	b.subscribers = append(b.subscribers, ch)
+	return ch
+}
+
+func (b *broker[T]) unsubscribe(ch <-chan T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, subscriber := range b.subscribers {
+		if subscriber == ch {
+			close(subscriber)
+			b.subscribers = append(b.subscribers[:i], b.subscribers[i+1:]...)
+			break
+		}
+	}
+}
+
+func (b *broker[T]) handle(fn func(T)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, fn)
+}
+
+// publish runs the callbacks in order and skips subscribers that are full
+func (b *broker[T]) publish(event T) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, fn := range b.handlers {
+		fn(event)
+	}
+	for _, ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// close ends every subscription
+func (b *broker[T]) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, ch := range b.subscribers {
+		close(ch)
+	}
+	b.subscribers = nil
+}
+
+// SubscribeDetections creates a new channel for receiving wakeword detections
+func (s *SnowGirl) SubscribeDetections() <-chan hotword.Detection {
+	return s.detections.subscribe()
+}
+
+// UnsubscribeDetections removes a detection subscriber
+func (s *SnowGirl) UnsubscribeDetections(ch <-chan hotword.Detection) {
+	s.detections.unsubscribe(ch)
+}
+
+// OnDetection registers a callback run on the listen loop for every detection,
+// it must return quickly to not hold up inference
+func (s *SnowGirl) OnDetection(fn func(hotword.Detection)) {
+	s.detections.handle(fn)
+}
+
+// SubscribeScores creates a new channel receiving the scores of every processed window
+func (s *SnowGirl) SubscribeScores() <-chan hotword.FrameScores {
+	return s.scores.subscribe()
+}
+
+// UnsubscribeScores removes a score subscriber
+func (s *SnowGirl) UnsubscribeScores(ch <-chan hotword.FrameScores) {
+	s.scores.unsubscribe(ch)
+}
+
+// OnScores registers a callback run on the listen loop for every processed window
+func (s *SnowGirl) OnScores(fn func(hotword.FrameScores)) {
+	s.scores.handle(fn)
+}
+
+// SubscribeVoice creates a new channel receiving the voice activity of every window
+func (s *SnowGirl) SubscribeVoice() <-chan vad.Decision {
+	return s.voice.subscribe()
+}
+
+// UnsubscribeVoice removes a voice activity subscriber
+func (s *SnowGirl) UnsubscribeVoice(ch <-chan vad.Decision) {
+	s.voice.unsubscribe(ch)
+}
+
+// OnVoice registers a callback run on the listen loop with the voice activity of every window
+func (s *SnowGirl) OnVoice(fn func(vad.Decision)) {
+	s.voice.handle(fn)
+}
+
+// SubscribeErrors creates a new channel receiving capture errors, the stream keeps
+// running while a lost device is reopened. Skipped windows arrive as ErrFallingBehind
+func (s *SnowGirl) SubscribeErrors() <-chan error {
+	return s.errors.subscribe()
+}
+
+// UnsubscribeErrors removes an error subscriber
+func (s *SnowGirl) UnsubscribeErrors(ch <-chan error) {
+	s.errors.unsubscribe(ch)
+}
+
+// OnError registers a callback run on the capture loop for every capture error
+func (s *SnowGirl) OnError(fn func(error)) {
+	s.errors.handle(fn)
+}
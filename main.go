@@ -4,41 +4,250 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/algo-boyz/snowgirl/pkg/audio"
 	"github.com/algo-boyz/snowgirl/pkg/hotword"
+	"github.com/algo-boyz/snowgirl/pkg/mic"
 	"github.com/algo-boyz/snowgirl/pkg/onnx"
 	"github.com/algo-boyz/snowgirl/pkg/state"
+	"github.com/algo-boyz/snowgirl/pkg/vad"
 )
 
 var (
-	ctx                              = state.NewContext()
-	hotwordEmbedPath, hotwordNetPath string
-	err                              error
+	ctx             = state.NewContext()
+	hotwordNetPath  string
+	threshold       float64
+	verbose         bool
+	policy          = hotword.DefaultPolicy()
+	silenceNetPath  string
+	speechThreshold float64
+	wakewords       wakewordFlags
+	raw             rawFlag
+	input           string
+	device          mic.Config
+	speed           float64
+	clips           = DefaultConfig().Clips
+	recordDir       string
+	channelMode     string
+	array           arrayFlag
+	recordLength    time.Duration
+	err             error
 )
 
 func init() {
 	flag.StringVar(&hotwordNetPath, "hotword", hotword.OnnxModelPath(), "efficient-wordnet .onnx path")
-	flag.StringVar(&hotwordEmbedPath, "embedding", hotword.EmbeddingsPath(), "hotword embedding .json path")
+	flag.Var(&wakewords, "embedding", "hotword embedding .json path with optional threshold path[:0.9], repeatable")
+	flag.StringVar(&silenceNetPath, "vad", "", "silero vad .onnx path, windows without speech skip hotword inference, e.g. "+vad.OnnxModelPath())
+	flag.Float64Var(&speechThreshold, "vad-threshold", 0.5, "speech probability above which a chunk counts as speech")
+	flag.BoolVar(&verbose, "verbose", false, "print the score of every wakeword for each window")
+	flag.IntVar(&policy.Required, "confirm", policy.Required, "windows above threshold required to confirm a wakeword")
+	flag.IntVar(&policy.Window, "confirm-of", policy.Window, "number of recent windows the -confirm count is taken from")
+	flag.DurationVar(&policy.Refractory, "refractory", policy.Refractory, "period a detected wakeword is suppressed for")
+	flag.StringVar(&input, "input", "", "audio file to listen to instead of the default input device, - reads a stream from stdin")
+	flag.StringVar(&device.Device, "device", "", "input device index or name substring, see the devices command")
+	flag.IntVar(&device.SampleRate, "rate", 0, "input device capture rate, defaults to 16000 or the device rate")
+	flag.IntVar(&device.Channels, "channels", 1, "input device channels to capture, e.g. 4 for a mic array")
+	flag.Var(&array, "array", "mic positions in metres x,y;x,y;... or circular:mics:radius, locates detections and captures a channel per mic")
+	flag.StringVar(&channelMode, "channel-mode", string(MixChannels), "detect on multiple -channels by mix to average them, best to take the best scoring one or snr for the clearest one")
+	flag.Float64Var(&speed, "speed", 1, "playback speed of an -input file, 1 is real time")
+	flag.Var(&raw, "raw", "read input files as headerless pcm encoding:rate:channels, e.g. s16le:16000:1 or f32le:48000:2")
+	flag.StringVar(&clips.Dir, "clips", "", "directory to record a wav and json of the audio around every detection to")
+	flag.DurationVar(&clips.PreRoll, "pre-roll", clips.PreRoll, "audio recorded before the end of a detected window")
+	flag.DurationVar(&clips.PostRoll, "post-roll", clips.PostRoll, "audio recorded after the end of a detected window")
+	flag.StringVar(&recordDir, "record", "", "directory to record the whole session to as wav files, e.g. for dataset collection")
+	flag.DurationVar(&recordLength, "record-length", 10*time.Minute, "length of each -record file")
+	flag.Float64Var(&threshold, "threshold", 0, "detection threshold for -embedding paths without one, defaults to the reference's suggestion or 0.9")
+}
+
+// wakewordFlags collects repeated -embedding flags
+type wakewordFlags []WakewordConfig
+
+func (w *wakewordFlags) String() string {
+	var paths = make([]string, len(*w))
+	for i, c := range *w {
+		paths[i] = c.EmbedPath
+	}
+	return strings.Join(paths, ",")
+}
+
+func (w *wakewordFlags) Set(value string) error {
+	var cfg = WakewordConfig{EmbedPath: value}
+	if i := strings.LastIndex(value, ":"); i > 0 {
+		if t, err := strconv.ParseFloat(value[i+1:], 32); err == nil {
+			cfg.EmbedPath, cfg.Threshold = value[:i], float32(t)
+		}
+	}
+	*w = append(*w, cfg)
+	return nil
+}
+
+// rawFlag marks input files as headerless pcm, which cannot be sniffed
+type rawFlag struct {
+	format *audio.RawFormat
+}
+
+func (r *rawFlag) String() string {
+	if r.format == nil {
+		return ""
+	}
+	return r.format.String()
+}
+
+func (r *rawFlag) Set(value string) error {
+	format, err := audio.ParseRawFormat(value)
+	if err != nil {
+		return err
+	}
+	r.format = &format
+	return nil
+}
+
+// arrayFlag places the mics of an array
+type arrayFlag struct {
+	geometry audio.ArrayGeometry
+	spec     string
+}
+
+func (a *arrayFlag) String() string {
+	return a.spec
+}
+
+func (a *arrayFlag) Set(value string) (err error) {
+	a.geometry, err = audio.ParseArrayGeometry(value)
+	a.spec = value
+	return err
+}
+
+// loadAudio decodes an input file as mono at the model rate, honouring -raw
+func loadAudio(filePath string) ([]float32, error) {
+	if raw.format != nil {
+		return audio.LoadRaw(filePath, *raw.format)
+	}
+	return audio.Load(filePath)
 }
 
 func main() {
 	flag.Parse()
 	go func() {
-		if err = run(ctx); err != nil {
+		if err = run(ctx, flag.Args()); err != nil {
 			log.Fatal(err)
 		}
+		ctx.Exit()
 	}()
 	ctx.AwaitExit()
 }
 
-func run(ctx state.Context) error {
+// run listens on the mic by default or runs the given command
+func run(ctx state.Context, args []string) error {
+	if len(args) > 0 && args[0] == "devices" {
+		return devices(args[1:])
+	}
 	if err = onnx.FetchRuntime(); err != nil {
 		return fmt.Errorf("path to onnx runtime is required: %w", err)
 	}
+	if len(args) > 0 {
+		switch args[0] {
+		case "enroll":
+			return enroll(ctx, args[1:])
+		case "scan":
+			return scan(ctx, args[1:])
+		case "eval":
+			return eval(ctx, args[1:])
+		case "serve":
+			return serve(ctx, args[1:])
+		default:
+			return fmt.Errorf("unknown command %s", args[0])
+		}
+	}
+	return listen(ctx)
+}
+
+// config applies the command line flags to the default config
+func config() Config {
+	var cfg = DefaultConfig()
+	cfg.HotwordNetPath = hotwordNetPath
+	cfg.Policy = policy
+	cfg.SilenceNetPath = silenceNetPath
+	cfg.SpeechThreshold = float32(speechThreshold)
+	cfg.Mic = device
+	cfg.ChannelMode = ChannelMode(channelMode)
+	if array.geometry != nil {
+		cfg.Array = array.geometry
+		if cfg.Mic.Channels <= 1 {
+			cfg.Mic.Channels = len(array.geometry)
+		}
+	}
+	cfg.Clips = clips
+	if len(wakewords) > 0 {
+		cfg.Wakewords = wakewords
+	}
+	for i := range cfg.Wakewords {
+		if cfg.Wakewords[i].Threshold == 0 {
+			cfg.Wakewords[i].Threshold = float32(threshold)
+		}
+	}
+	return cfg
+}
 
-	snowgirl, err := NewSnowGirl(ctx, DefaultConfig())
+// inputSource opens -input, a nil source captures from the default input device
+func inputSource() (audio.AudioSource, error) {
+	switch input {
+	case "":
+		return nil, nil
+	case "-":
+		return audio.NewStdinSource(raw.format)
+	default:
+		return audio.NewFileSource(input, raw.format, speed)
+	}
+}
+
+func listen(ctx state.Context) error {
+	var cfg = config()
+	if cfg.Source, err = inputSource(); err != nil {
+		return err
+	}
+	if input != "" && input != "-" {
+		// a file waits for detection instead of skipping windows
+		cfg.Backpressure = audio.Block
+	}
+	if recordDir != "" {
+		sink, err := audio.NewRotatingSink(ctx, recordDir, "session", recordLength)
+		if err != nil {
+			return err
+		}
+		cfg.Sinks = append(cfg.Sinks, sink)
+	}
+	snowgirl, err := NewSnowGirl(ctx, cfg)
 	if err != nil {
 		return err
 	}
+	snowgirl.OnDetection(func(d hotword.Detection) {
+		fmt.Printf("%s %s DETECTED! confidence: %f\n", d.Time.Format(time.TimeOnly), d.Wakeword, d.Confidence)
+		if device.Channels > 1 && d.Channel >= 0 {
+			fmt.Printf("heard best on channel %d\n", d.Channel)
+		}
+		if d.Azimuth != nil {
+			fmt.Printf("came from %.0f degrees\n", *d.Azimuth)
+		}
+		if d.Clip != "" {
+			fmt.Printf("recording %s\n", d.Clip)
+		}
+	})
+	snowgirl.OnError(func(err error) {
+		fmt.Printf("%s capture error: %s\n", time.Now().Format(time.TimeOnly), err)
+	})
+	if verbose {
+		snowgirl.OnScores(func(f hotword.FrameScores) {
+			for _, score := range f.Scores {
+				fmt.Printf("%s %s confidence: %f\n", f.Time.Format(time.TimeOnly), score.Wakeword, score.Confidence)
+			}
+		})
+		snowgirl.OnVoice(func(d vad.Decision) {
+			fmt.Printf("%s speech: %t probability: %f\n", d.Time.Format(time.TimeOnly), d.Speech, d.Probability)
+		})
+	}
 	return snowgirl.Listen()
 }
@@ -1,7 +1,12 @@
 package main
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/algo-boyz/snowgirl/pkg/audio"
 	"github.com/algo-boyz/snowgirl/pkg/hotword"
@@ -33,3 +38,136 @@ func TestSnowgirl(t *testing.T) {
 
 	require.True(t, confidence > 0.7, "expected confidence > 0.7 got %f", confidence)
 }
+
+func TestSaveClip(t *testing.T) {
+	var (
+		cfg       = ClipConfig{Dir: t.TempDir(), PreRoll: time.Second, PostRoll: time.Second}
+		detection = hotword.Detection{Wakeword: "hey computer", Confidence: 0.95, Time: time.Now()}
+		clip      = audio.Frame{Samples: make([]float32, audio.Samples(2)), Time: detection.Time.Add(cfg.PostRoll)}
+	)
+	detection.Clip = cfg.clipPath(detection)
+	require.Equal(t, cfg.Dir, filepath.Dir(detection.Clip))
+	require.True(t, strings.HasPrefix(filepath.Base(detection.Clip), "hey_computer_"), detection.Clip)
+	require.NoError(t, saveClip(detection, clip))
+
+	pcm, err := audio.Decode(detection.Clip)
+	require.NoError(t, err)
+	require.Equal(t, len(clip.Samples), pcm.Frames())
+
+	b, err := os.ReadFile(strings.TrimSuffix(detection.Clip, ".wav") + ".json")
+	require.NoError(t, err)
+	var meta clipMeta
+	require.NoError(t, json.Unmarshal(b, &meta))
+	require.Equal(t, detection.Wakeword, meta.Wakeword)
+	require.True(t, meta.Time.Equal(detection.Time))
+	require.True(t, meta.Start.Equal(detection.Time.Add(-cfg.PreRoll)), "clip starts %s before the detection", detection.Time.Sub(meta.Start))
+}
+
+func TestChannelMode(t *testing.T) {
+	var cfg = DefaultConfig()
+	cfg.ChannelMode = "loudest"
+	_, err := NewSnowGirl(state.NewContext(), cfg)
+	require.ErrorContains(t, err, "unknown channel mode")
+}
+
+func TestPauseResume(t *testing.T) {
+	// a file streams 3s ahead of the wall clock before detection resumes
+	var stream = audio.NewAudioStream(state.NewContext(), audio.NewPCMSource(&audio.PCM{Samples: make([]float32, 48000), SampleRate: audio.SampleRate, Channels: 1}, 10), windowLengthSecs, slidingWindowSecs)
+	var frames = stream.Subscribe(audio.SubscribeOptions{})
+	require.NoError(t, stream.Start())
+	for range frames {
+	}
+	var (
+		snowgirl = &SnowGirl{stream: stream}
+		window   = make([]float32, 24000) // 1.5s at 16kHz
+	)
+	require.True(t, snowgirl.active(audio.Frame{Samples: window, End: 24000}))
+
+	snowgirl.Pause()
+	require.False(t, snowgirl.active(audio.Frame{Samples: window, End: 48000}), "paused frames must be skipped")
+
+	snowgirl.Resume()
+	require.False(t, snowgirl.active(audio.Frame{Samples: window, End: 48000}), "window captured before the resume must be flushed")
+	require.False(t, snowgirl.active(audio.Frame{Samples: window, End: 60000}), "window overlapping the resume must be flushed")
+	require.True(t, snowgirl.active(audio.Frame{Samples: window, End: 72000}))
+
+	snowgirl.PauseFor(10 * time.Millisecond)
+	require.True(t, snowgirl.Paused())
+	require.Eventually(t, func() bool { return !snowgirl.Paused() }, time.Second, time.Millisecond)
+
+	// a later pause replaces the resume of an earlier PauseFor
+	snowgirl.PauseFor(time.Millisecond)
+	snowgirl.Pause()
+	time.Sleep(20 * time.Millisecond)
+	require.True(t, snowgirl.Paused())
+}
+
+func TestDetectionEvents(t *testing.T) {
+	var (
+		snowgirl  = &SnowGirl{}
+		detection = hotword.Detection{Wakeword: "computer", Confidence: 0.95, Time: time.Now()}
+		handled   []hotword.Detection
+	)
+	snowgirl.OnDetection(func(d hotword.Detection) {
+		handled = append(handled, d)
+	})
+	detections := snowgirl.SubscribeDetections()
+	snowgirl.detections.publish(detection)
+
+	require.Equal(t, detection, <-detections)
+	require.Equal(t, []hotword.Detection{detection}, handled)
+
+	snowgirl.UnsubscribeDetections(detections)
+	_, ok := <-detections
+	require.False(t, ok, "expected detection channel to be closed")
+}
+
+func TestScan(t *testing.T) {
+	var cfg = DefaultConfig()
+	cfg.Wakewords = []WakewordConfig{{EmbedPath: "model/hotword/computer_ref.json", Threshold: 0.7}}
+	model, detector, err := newDetector(state.NewContext(), cfg)
+	require.NoError(t, err, "failed to init detector")
+	defer func() {
+		require.NoError(t, model.Destroy(), "failed to destroy onnx session")
+	}()
+
+	var detections []scanDetection
+	err = scanFile(detector, hotword.DefaultLogMelSpectrogram(), "model/hotword/computer.mp3", func(d scanDetection) error {
+		detections = append(detections, d)
+		return nil
+	})
+	require.NoError(t, err, "failed to scan mp3")
+	require.NotEmpty(t, detections, "expected computer to be detected")
+	require.Equal(t, "computer", detections[0].Wakeword)
+	require.Less(t, detections[0].Start, detections[0].End)
+
+	// the next file restarts the clock, the first file's refractory period must not suppress it
+	var first = len(detections)
+	err = scanFile(detector, hotword.DefaultLogMelSpectrogram(), "model/hotword/computer.mp3", func(d scanDetection) error {
+		detections = append(detections, d)
+		return nil
+	})
+	require.NoError(t, err, "failed to scan second mp3")
+	require.Greater(t, len(detections), first, "expected computer to be detected in the second file")
+	require.Equal(t, detections[0].Start, detections[first].Start)
+}
+
+func TestListenFile(t *testing.T) {
+	source, err := audio.NewFileSource("model/hotword/computer.mp3", nil, 10)
+	require.NoError(t, err, "failed to open file source")
+	var cfg = DefaultConfig()
+	cfg.Wakewords = []WakewordConfig{{EmbedPath: "model/hotword/computer_ref.json", Threshold: 0.7}}
+	cfg.Source = source
+	snowgirl, err := NewSnowGirl(state.NewContext(), cfg)
+	require.NoError(t, err, "failed to init snowgirl")
+	defer func() {
+		require.NoError(t, snowgirl.hotwordModel.Destroy(), "failed to destroy onnx session")
+	}()
+
+	var detections []hotword.Detection
+	snowgirl.OnDetection(func(d hotword.Detection) {
+		detections = append(detections, d)
+	})
+	require.NoError(t, snowgirl.Listen(), "expected listen to return when the file ends")
+	require.NotEmpty(t, detections, "expected computer to be detected")
+}
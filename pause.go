@@ -0,0 +1,83 @@
+package main
+
+import (
+	"time"
+
+	"github.com/algo-boyz/snowgirl/pkg/audio"
+)
+
+// Pause stops feature extraction and inference while the mic stream stays open
+func (s *SnowGirl) Pause() {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+	s.pause()
+}
+
+// PauseFor pauses hotword detection and resumes it automatically after d
+func (s *SnowGirl) PauseFor(d time.Duration) {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+	var pauses = s.pause()
+	s.resumeTimer = time.AfterFunc(d, func() {
+		s.pauseMu.Lock()
+		defer s.pauseMu.Unlock()
+		// a timer that fired while a newer pause took the lock must not end it
+		if s.pauses == pauses {
+			s.resume()
+		}
+	})
+}
+
+// Resume restarts hotword detection, windows captured before the resume are flushed
+func (s *SnowGirl) Resume() {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+	s.resume()
+}
+
+// pause replaces any pending resume and returns the number of the new pause
+func (s *SnowGirl) pause() uint64 {
+	s.stopResumeTimer()
+	s.paused = true
+	s.pauses++
+	return s.pauses
+}
+
+func (s *SnowGirl) resume() {
+	s.stopResumeTimer()
+	if s.paused {
+		s.paused = false
+		// windows are compared by stream position, file input runs ahead of the wall clock
+		if s.stream != nil {
+			s.resumedAt = s.stream.Position()
+		}
+		if s.detector != nil {
+			s.detector.Reset()
+		}
+		if s.vad != nil {
+			s.vad.Reset()
+		}
+	}
+}
+
+// Paused reports whether hotword detection is paused
+func (s *SnowGirl) Paused() bool {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+	return s.paused
+}
+
+// active reports whether a frame should be processed, which requires detection to be
+// running and the whole window to be captured after the last resume
+func (s *SnowGirl) active(frame audio.Frame) bool {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+	return !s.paused && frame.End-int64(len(frame.Samples)) >= s.resumedAt
+}
+
+func (s *SnowGirl) stopResumeTimer() {
+	if s.resumeTimer != nil {
+		s.resumeTimer.Stop()
+		s.resumeTimer = nil
+	}
+}
@@ -1,80 +1,201 @@
 package audio
 
 import (
+	"bufio"
+	"bytes"
 	_ "embed"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
-	"github.com/go-audio/wav"
 	"github.com/hajimehoshi/go-mp3"
 	"go.uber.org/multierr"
 )
 
-func Load(filePath string) (frame []float32, err error) {
-	switch ext := filepath.Ext(filePath); ext {
+// PCM is decoded interleaved audio in its original sample rate and channel count
+type PCM struct {
+	Samples    []float32
+	SampleRate int
+	Channels   int
+}
+
+// Frames returns the number of samples per channel
+func (p *PCM) Frames() int {
+	if p.Channels == 0 {
+		return 0
+	}
+	return len(p.Samples) / p.Channels
+}
+
+// Mono downmixes all channels by averaging them
+func (p *PCM) Mono() []float32 {
+	if p.Channels <= 1 {
+		return p.Samples
+	}
+	var mono = make([]float32, p.Frames())
+	for i := range mono {
+		var sum float32
+		for c := 0; c < p.Channels; c++ {
+			sum += p.Samples[i*p.Channels+c]
+		}
+		mono[i] = sum / float32(p.Channels)
+	}
+	return mono
+}
+
+// Channel selects a single channel
+func (p *PCM) Channel(channel int) ([]float32, error) {
+	if channel < 0 || channel >= p.Channels {
+		return nil, fmt.Errorf("channel %d out of range, audio has %d channels", channel, p.Channels)
+	}
+	var samples = make([]float32, p.Frames())
+	for i := range samples {
+		samples[i] = p.Samples[i*p.Channels+channel]
+	}
+	return samples, nil
+}
+
+// Format is an audio file encoding recognised by Decode
+type Format string
+
+const (
+	FormatWAV    Format = "wav"
+	FormatMP3    Format = "mp3"
+	FormatFLAC   Format = "flac"
+	FormatVorbis Format = "vorbis"
+	FormatOpus   Format = "opus"
+)
+
+// sniffSize is enough to hold an Ogg page header and the start of its first packet
+const sniffSize = 64
+
+// Sniff detects the format from the leading bytes of a file, it returns an empty format
+// for anything it does not recognise, including headerless pcm
+func Sniff(head []byte) Format {
+	switch {
+	case len(head) >= 12 && string(head[0:4]) == "RIFF" && string(head[8:12]) == "WAVE":
+		return FormatWAV
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return FormatFLAC
+	case bytes.HasPrefix(head, []byte("OggS")):
+		return oggCodec(head)
+	case bytes.HasPrefix(head, []byte("ID3")):
+		return FormatMP3
+	case len(head) >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0:
+		// MPEG frame sync
+		return FormatMP3
+	default:
+		return ""
+	}
+}
+
+// formatFromExt is the fallback when sniffing fails
+func formatFromExt(ext string) Format {
+	switch strings.ToLower(ext) {
+	case ".wav", ".wave":
+		return FormatWAV
 	case ".mp3":
-		return loadMP3(filePath)
-	case ".wav":
-		return loadWAV(filePath)
+		return FormatMP3
+	case ".flac":
+		return FormatFLAC
+	case ".ogg", ".oga":
+		return FormatVorbis
+	case ".opus":
+		return FormatOpus
 	default:
-		return nil, fmt.Errorf("unsupported audio file extension: %s", ext)
+		return ""
 	}
 }
 
-func loadMP3(filePath string) (frame []float32, err error) {
+// Load decodes an audio file, downmixes it to mono and resamples it to the model rate
+func Load(filePath string) (frame []float32, err error) {
+	pcm, err := Decode(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return Resample(pcm.Mono(), pcm.SampleRate, SampleRate)
+}
+
+// LoadRaw is Load for headerless pcm
+func LoadRaw(filePath string, format RawFormat) (frame []float32, err error) {
 	audioFile, err := os.Open(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("error opening MP3 file: %v", err)
+		return nil, fmt.Errorf("error opening raw pcm file: %v", err)
 	}
 	defer func() {
 		err = multierr.Combine(err, audioFile.Close())
 	}()
-	// Decode the MP3 file
-	decoder, err := mp3.NewDecoder(audioFile)
+	pcm, err := DecodeRaw(bufio.NewReader(audioFile), format)
 	if err != nil {
-		return nil, fmt.Errorf("error creating MP3 decoder: %v", err)
-	}
-	// Read audio data
-	var b = make([]byte, sampleRate*2) // 16-bit audio, so 2 bytes per sample
-	n, err := decoder.Read(b)
-	if err != nil && err != io.EOF {
-		return nil, fmt.Errorf("error reading MP3 data: %v", err)
+		return nil, err
 	}
-	// Convert to float64 slice
-	frame = make([]float32, n/2)
-	for i := 0; i < len(frame); i++ {
-		// Convert 16-bit PCM to float64
-		var sample = int16(b[i*2]) | int16(b[i*2+1])<<8
-		frame[i] = float32(sample) / 32768.0
-	}
-	return frame, nil
+	return Resample(pcm.Mono(), pcm.SampleRate, SampleRate)
 }
 
-func loadWAV(filePath string) (frame []float32, err error) {
+// Decode reads a whole audio file keeping its sample rate and channels, the format is
+// sniffed from its leading bytes so wrong or missing extensions still load
+func Decode(filePath string) (pcm *PCM, err error) {
 	audioFile, err := os.Open(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("error opening WAV file: %v", err)
+		return nil, fmt.Errorf("error opening audio file: %v", err)
 	}
 	defer func() {
 		err = multierr.Combine(err, audioFile.Close())
 	}()
-	// Decode the WAV file
-	decoder := wav.NewDecoder(audioFile)
-	// Check if the file is valid and has PCM format
-	if !decoder.IsValidFile() {
-		return nil, fmt.Errorf("invalid WAV file")
-	}
-	// Decode WAV file to PCM samples
-	buffer, err := decoder.FullPCMBuffer()
+	return decode(bufio.NewReader(audioFile), formatFromExt(filepath.Ext(filePath)))
+}
+
+// DecodeReader reads a whole audio stream, its format is sniffed from the leading bytes
+func DecodeReader(r io.Reader) (*PCM, error) {
+	return decode(bufio.NewReader(r), "")
+}
+
+func decode(r *bufio.Reader, fallback Format) (*PCM, error) {
+	// Peek returns fewer bytes for short files, which are then left to the fallback
+	head, _ := r.Peek(sniffSize)
+	var format = Sniff(head)
+	if format == "" {
+		format = fallback
+	}
+	switch format {
+	case FormatWAV:
+		return decodeWAV(r)
+	case FormatMP3:
+		return decodeMP3(r)
+	case FormatFLAC:
+		return decodeFLAC(r)
+	case FormatVorbis:
+		return decodeVorbis(r)
+	case FormatOpus:
+		return decodeOpus(r)
+	default:
+		return nil, fmt.Errorf("unrecognised audio format, use a raw format for headerless pcm")
+	}
+}
+
+func decodeMP3(r io.Reader) (*PCM, error) {
+	decoder, err := mp3.NewDecoder(r)
 	if err != nil {
-		return nil, fmt.Errorf("error decoding WAV file: %v", err)
+		return nil, fmt.Errorf("error creating MP3 decoder: %v", err)
 	}
-	// Convert PCM int samples to float32
-	frame = make([]float32, len(buffer.Data))
-	for i, sample := range buffer.Data {
-		frame[i] = float32(sample / 1 << 15) // Assuming 16-bit PCM
+	// Read all audio data, go-mp3 always decodes to 16-bit interleaved stereo
+	b, err := io.ReadAll(decoder)
+	if err != nil {
+		return nil, fmt.Errorf("error reading MP3 data: %v", err)
+	}
+	var pcm = &PCM{
+		Samples:    make([]float32, len(b)/2),
+		SampleRate: decoder.SampleRate(),
+		Channels:   2,
+	}
+	for i := range pcm.Samples {
+		// Convert 16-bit PCM to float32
+		var sample = int16(b[i*2]) | int16(b[i*2+1])<<8
+		pcm.Samples[i] = float32(sample) / 32768.0
 	}
-	return frame, nil
+	// Drop a trailing partial frame
+	pcm.Samples = pcm.Samples[:pcm.Frames()*pcm.Channels]
+	return pcm, nil
 }
@@ -0,0 +1,181 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeMP3(t *testing.T) {
+	pcm, err := Decode("../../model/hotword/computer.mp3")
+	require.NoError(t, err, "failed to decode mp3")
+	require.Equal(t, 22050, pcm.SampleRate)
+	require.Equal(t, 2, pcm.Channels)
+	require.Greater(t, float64(pcm.Frames())/float64(pcm.SampleRate), 1.0, "expected the whole clip to be decoded")
+
+	mono := pcm.Mono()
+	require.Len(t, mono, pcm.Frames())
+	left, err := pcm.Channel(0)
+	require.NoError(t, err)
+	require.Equal(t, left, mono, "expected a mono mp3 to decode to identical channels")
+	_, err = pcm.Channel(2)
+	require.Error(t, err)
+}
+
+// wavFixture encodes interleaved samples in [-1, 1) as a WAV file
+func wavFixture(t *testing.T, format, bitDepth, channels, rate int, samples []float64) string {
+	t.Helper()
+	var (
+		bytesPerSample = bitDepth / 8
+		data           = make([]byte, 0, len(samples)*bytesPerSample)
+		// extensible fixtures always carry float samples
+		float = format == wavFormatFloat || format == wavFormatExtensible
+	)
+	for _, s := range samples {
+		switch {
+		case float && bitDepth == 32:
+			data = binary.LittleEndian.AppendUint32(data, math.Float32bits(float32(s)))
+		case float && bitDepth == 64:
+			data = binary.LittleEndian.AppendUint64(data, math.Float64bits(s))
+		case bitDepth == 8:
+			data = append(data, byte(int(math.Round(s*128))+128))
+		default:
+			v := uint32(int32(math.Round(s * float64(int64(1)<<(bitDepth-1)))))
+			for i := 0; i < bytesPerSample; i++ {
+				data = append(data, byte(v>>(8*i)))
+			}
+		}
+	}
+	var fmtChunk []byte
+	fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, uint16(format))
+	fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, uint16(channels))
+	fmtChunk = binary.LittleEndian.AppendUint32(fmtChunk, uint32(rate))
+	fmtChunk = binary.LittleEndian.AppendUint32(fmtChunk, uint32(rate*channels*bytesPerSample))
+	fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, uint16(channels*bytesPerSample))
+	fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, uint16(bitDepth))
+	if format == wavFormatExtensible {
+		fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, 22)
+		fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, uint16(bitDepth))
+		fmtChunk = binary.LittleEndian.AppendUint32(fmtChunk, 0)
+		// KSDATAFORMAT_SUBTYPE_IEEE_FLOAT
+		fmtChunk = append(fmtChunk, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xAA, 0x00, 0x38, 0x9B, 0x71)
+	}
+	var chunk = func(b []byte, id string, body []byte) []byte {
+		b = append(b, id...)
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(body)))
+		b = append(b, body...)
+		if len(body)%2 == 1 {
+			b = append(b, 0)
+		}
+		return b
+	}
+	var body = []byte("WAVE")
+	body = chunk(body, "fmt ", fmtChunk)
+	// unknown chunks are skipped, the odd size checks the pad byte
+	body = chunk(body, "LIST", []byte("INFOx"))
+	body = chunk(body, "data", data)
+	var file = chunk(nil, "RIFF", body)
+
+	path := filepath.Join(t.TempDir(), "fixture.wav")
+	require.NoError(t, os.WriteFile(path, file, 0o644))
+	return path
+}
+
+func TestDecodeWAV(t *testing.T) {
+	// interleaved frames of a ramp on the first channel and its inverse on the second
+	var stereo = []float64{0, 0, 0.25, -0.25, 0.5, -0.5, -0.75, 0.75, -1, 0.5}
+	for _, tc := range []struct {
+		name      string
+		format    int
+		bitDepth  int
+		channels  int
+		rate      int
+		samples   []float64
+		tolerance float64
+	}{
+		{"8-bit mono", wavFormatPCM, 8, 1, 8000, []float64{0, 0.5, -0.5, -1, 0.25}, 1.0 / 128},
+		{"16-bit mono", wavFormatPCM, 16, 1, 16000, []float64{0, 0.5, -0.5, -1, 0.123}, 1.0 / (1 << 15)},
+		{"16-bit stereo", wavFormatPCM, 16, 2, 44100, stereo, 1.0 / (1 << 15)},
+		{"24-bit stereo", wavFormatPCM, 24, 2, 48000, stereo, 1.0 / (1 << 23)},
+		{"32-bit mono", wavFormatPCM, 32, 1, 16000, []float64{0, 0.5, -0.5, -1, 0.123}, 1e-6},
+		{"float32 stereo", wavFormatFloat, 32, 2, 22050, stereo, 1e-7},
+		{"float64 mono", wavFormatFloat, 64, 1, 16000, []float64{0, 0.5, -0.5, -1, 0.123}, 1e-7},
+		{"extensible float32 4 channels", wavFormatExtensible, 32, 4, 48000, []float64{0.1, 0.2, 0.3, 0.4, -0.1, -0.2, -0.3, -0.4}, 1e-7},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pcm, err := Decode(wavFixture(t, tc.format, tc.bitDepth, tc.channels, tc.rate, tc.samples))
+			require.NoError(t, err)
+			require.Equal(t, tc.rate, pcm.SampleRate)
+			require.Equal(t, tc.channels, pcm.Channels)
+			require.Equal(t, len(tc.samples)/tc.channels, pcm.Frames())
+			for i, want := range tc.samples {
+				require.InDelta(t, want, pcm.Samples[i], tc.tolerance, "sample %d", i)
+			}
+			for c := 0; c < tc.channels; c++ {
+				channel, err := pcm.Channel(c)
+				require.NoError(t, err)
+				for i := range channel {
+					require.InDelta(t, tc.samples[i*tc.channels+c], channel[i], tc.tolerance, "channel %d frame %d", c, i)
+				}
+			}
+			mono := pcm.Mono()
+			for i := range mono {
+				var sum float64
+				for c := 0; c < tc.channels; c++ {
+					sum += tc.samples[i*tc.channels+c]
+				}
+				require.InDelta(t, sum/float64(tc.channels), mono[i], tc.tolerance, "mono frame %d", i)
+			}
+		})
+	}
+}
+
+func TestSaveWAV(t *testing.T) {
+	var (
+		path = filepath.Join(t.TempDir(), "clip.wav")
+		pcm  = &PCM{Samples: []float32{0, 0.5, -0.5, -1, 0.25, 1.5}, SampleRate: 16000, Channels: 2}
+	)
+	require.NoError(t, SaveWAV(path, pcm))
+	decoded, err := Decode(path)
+	require.NoError(t, err)
+	require.Equal(t, pcm.SampleRate, decoded.SampleRate)
+	require.Equal(t, pcm.Channels, decoded.Channels)
+	// samples out of range are clipped
+	for i, want := range []float32{0, 0.5, -0.5, -1, 0.25, 1} {
+		require.InDelta(t, want, decoded.Samples[i], 1.0/(1<<15), "sample %d", i)
+	}
+}
+
+func TestDecodeWAVErrors(t *testing.T) {
+	_, err := Decode(wavFixture(t, wavFormatPCM, 12, 1, 16000, nil))
+	require.Error(t, err, "expected an unsupported bit depth to fail")
+
+	path := filepath.Join(t.TempDir(), "bad.wav")
+	require.NoError(t, os.WriteFile(path, []byte("RIFF\x04\x00\x00\x00AVI "), 0o644))
+	_, err = Decode(path)
+	require.Error(t, err, "expected a non WAVE riff file to fail")
+
+	// a fmt chunk size of 0xFFFFFFFF must neither wrap its padding nor allocate 4GiB
+	var header = []byte("RIFF\x24\x00\x00\x00WAVEfmt \xff\xff\xff\xff")
+	_, err = DecodeReader(bytes.NewReader(header))
+	require.ErrorContains(t, err, "invalid WAV fmt chunk size")
+}
+
+func TestDecodeAlexa(t *testing.T) {
+	pcm, err := Decode("../../model/hotword/alexa.wav")
+	require.NoError(t, err)
+	require.Equal(t, 44100, pcm.SampleRate)
+	require.Equal(t, 2, pcm.Channels)
+	var peak float32
+	for _, s := range pcm.Samples {
+		require.LessOrEqual(t, s, float32(1))
+		require.GreaterOrEqual(t, s, float32(-1))
+		peak = max(peak, s, -s)
+	}
+	require.Greater(t, peak, float32(0.01), "expected audible samples")
+}
@@ -1,204 +1,586 @@
 package audio
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"sync"
-	"unsafe"
+	"sync/atomic"
+	"time"
 
 	"github.com/algo-boyz/snowgirl/pkg/state"
-	"github.com/gordonklaus/portaudio"
 )
 
-// AudioStream implements a sliding window audio stream
+// AudioStream cuts sliding windows out of a shared capture history, each subscriber
+// with its own window length and hop
 type AudioStream struct {
-	openStream    func() error
-	closeStream   func() error
-	getNextFrame  func() ([]float32, error)
-	windowSize    int
-	slidingWindow int
-	mu            sync.Mutex
+	ctx          state.Context
+	source       AudioSource
+	getNextFrame func() ([][]float32, error)
+	history      *ringBuffer
+	channels     []*ringBuffer // every channel of a multi-channel source, history holds their average
+	cursor       cursor
+	ended        bool
+	started      time.Time
+	subscribers  []*subscriber
+	handlers     []func(error)
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	mu           sync.Mutex
 }
 
-const sampleRate = 16000
+// SampleRate is the rate of the model, every frame of a stream is resampled to it
+const SampleRate = 16000
 
-// NewAudioStream creates a new AudioStream
+// Lost sources are reopened after a backoff doubling from reopenBackoff up to maxReopenBackoff
+const (
+	reopenBackoff    = 100 * time.Millisecond
+	maxReopenBackoff = 5 * time.Second
+)
+
+// reopener is implemented by sources that can recover from a failed read, e.g. an unplugged device
+type reopener interface {
+	Reopen() error
+}
+
+// readChunkSize is the number of samples at the model rate written to the history per read
+const readChunkSize = SampleRate / 100
+
+// Frame is a window of mono pcm samples stamped with the capture time of its last sample
+type Frame struct {
+	Samples []float32
+	// Channels are the windows of every channel of a multi-channel source, Samples is their average
+	Channels [][]float32
+	Time     time.Time
+	// Seq numbers the windows cut for a subscriber, a jump means windows were dropped
+	Seq uint64
+	// End is the stream Position just past the last sample of the window
+	End int64
+}
+
+// Start returns the capture time of the first sample in the window
+func (f Frame) Start() time.Time {
+	return f.Time.Add(-samplesDuration(int64(len(f.Samples))))
+}
+
+// samplesDuration converts a number of samples at the model rate to a duration through
+// whole seconds, nanoseconds times the rate overflow after a week of capture
+func samplesDuration(samples int64) time.Duration {
+	return time.Duration(samples/SampleRate)*time.Second + time.Duration(samples%SampleRate)*time.Second/SampleRate
+}
+
+// Backpressure decides what happens to a window when its subscriber's channel is full
+type Backpressure int
+
+const (
+	// DropNewest discards the window that does not fit
+	DropNewest Backpressure = iota
+	// DropOldest discards the oldest queued window to make room, keeping latency low
+	DropOldest
+	// Block waits up to the subscriber's timeout for room, stalling the stream, then drops the window
+	Block
+)
+
+// DefaultBlockTimeout bounds how long a Block subscriber may stall the stream
+const DefaultBlockTimeout = time.Second
+
+// SubscribeOptions sets the window a subscriber receives, zero values use the stream's window and hop
+type SubscribeOptions struct {
+	WindowSecs   float32
+	HopSecs      float32
+	Backpressure Backpressure
+	// Timeout of Block, zero uses DefaultBlockTimeout
+	Timeout time.Duration
+}
+
+// SubscriberStats counts the windows cut for a subscriber. Delivered windows were queued
+// on its channel, dropped ones were discarded or evicted by its backpressure policy
+type SubscriberStats struct {
+	Delivered uint64
+	Dropped   uint64
+}
+
+// subscriber windows are cut under the stream's lock and sent outside of it, so a
+// blocked send only holds up the stream's reads and its own subscriber
+type subscriber struct {
+	ch           chan Frame
+	backpressure Backpressure
+	timeout      time.Duration
+	delivered    atomic.Uint64
+	dropped      atomic.Uint64
+	// mu orders sends before closing the channel
+	mu     sync.Mutex
+	closed bool
+	// once subscribers receive a single window and are then removed
+	once bool
+	cursor
+}
+
+// deliver sends frames cut for the subscriber unless it was closed meanwhile,
+// once subscribers are closed after their window
+func (sub *subscriber) deliver(frames []Frame) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	for _, frame := range frames {
+		if sub.closed {
+			return
+		}
+		sub.send(frame)
+	}
+	if sub.once && !sub.closed {
+		close(sub.ch)
+		sub.closed = true
+	}
+}
+
+// close closes the channel unless it already is
+func (sub *subscriber) close() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if !sub.closed {
+		close(sub.ch)
+		sub.closed = true
+	}
+}
+
+func (sub *subscriber) stats() SubscriberStats {
+	return SubscriberStats{Delivered: sub.delivered.Load(), Dropped: sub.dropped.Load()}
+}
+
+// send queues a frame according to the backpressure policy
+func (sub *subscriber) send(frame Frame) {
+	switch sub.backpressure {
+	case DropOldest:
+		for {
+			select {
+			case sub.ch <- frame:
+				sub.delivered.Add(1)
+				return
+			default:
+				// evict the oldest window, the subscriber may have emptied the channel meanwhile
+				select {
+				case <-sub.ch:
+					sub.delivered.Add(^uint64(0))
+					sub.dropped.Add(1)
+				default:
+				}
+			}
+		}
+	case Block:
+		var timer = time.NewTimer(sub.timeout)
+		defer timer.Stop()
+		select {
+		case sub.ch <- frame:
+			sub.delivered.Add(1)
+		case <-timer.C:
+			sub.dropped.Add(1)
+		}
+	default:
+		select {
+		case sub.ch <- frame:
+			sub.delivered.Add(1)
+		default:
+			// Skip if channel is full to prevent blocking
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// cursor cuts a window every hop samples, end is the position just past its next window
+// and seq the number of windows cut so far
+type cursor struct {
+	window int
+	hop    int
+	end    int64
+	seq    uint64
+}
+
+// due reports whether the next window is complete, once the stream ended a last
+// window is due while samples after the previous one remain
+func (c *cursor) due(written int64, ended bool) bool {
+	if ended {
+		return c.end-int64(c.hop) < written
+	}
+	return c.end <= written
+}
+
+// NewAudioStream slides a window over the source, resampling it to the model rate when needed.
+// The window and hop are the defaults of GetFrame and subscribers
 func NewAudioStream(
-	openStream func() error,
-	closeStream func() error,
-	getNextFrame func() ([]float32, error),
+	ctx state.Context,
+	source AudioSource,
 	windowLengthSecs float32,
 	slidingWindowSecs float32,
 ) *AudioStream {
+	var stream = &AudioStream{
+		ctx:          ctx,
+		source:       source,
+		getNextFrame: chunks(source),
+		history:      newRingBuffer(readChunkSize),
+		subscribers:  make([]*subscriber, 0),
+		minBackoff:   reopenBackoff,
+		maxBackoff:   maxReopenBackoff,
+	}
+	if n := sourceChannels(source); n > 1 {
+		stream.channels = make([]*ringBuffer, n)
+		for c := range stream.channels {
+			stream.channels[c] = newRingBuffer(readChunkSize)
+		}
+	}
+	stream.cursor = stream.newCursor(SubscribeOptions{
+		WindowSecs: windowLengthSecs,
+		HopSecs:    slidingWindowSecs,
+	})
+	return stream
+}
+
+// chunks reads the source in chunks at the model rate, one per channel
+func chunks(source AudioSource) func() ([][]float32, error) {
 	var (
-		windowSize        = int(windowLengthSecs * float32(sampleRate))
-		slidingWindowSize = int(max(1, slidingWindowSecs*float32(sampleRate)))
+		channels = sourceChannels(source)
+		next     = channelReaders(source.Read, channels)
+		readers  = make([]func() ([]float32, error), channels)
 	)
-	return &AudioStream{
-		openStream:    openStream,
-		closeStream:   closeStream,
-		getNextFrame:  getNextFrame,
-		windowSize:    windowSize,
-		slidingWindow: slidingWindowSize,
+	for c := range readers {
+		var resampler *Resampler
+		if source.SampleRate() != SampleRate {
+			var err error
+			if resampler, err = NewResampler(source.SampleRate(), SampleRate); err != nil {
+				return func() ([][]float32, error) {
+					return nil, err
+				}
+			}
+		}
+		readers[c] = resampledFrames(next[c], resampler, readChunkSize)
+	}
+	return func() ([][]float32, error) {
+		var frames = make([][]float32, channels)
+		for c, read := range readers {
+			frame, err := read()
+			if err != nil {
+				return nil, err
+			}
+			frames[c] = frame
+		}
+		return frames, nil
+	}
+}
+
+// newCursor starts a cursor at the current position and grows the history to fit its window
+func (c *AudioStream) newCursor(opts SubscribeOptions) cursor {
+	var (
+		window = int(opts.WindowSecs * float32(SampleRate))
+		hop    = int(max(1, opts.HopSecs*float32(SampleRate)))
+	)
+	if opts.WindowSecs == 0 {
+		window = c.cursor.window
+	}
+	if opts.HopSecs == 0 {
+		hop = c.cursor.hop
+	}
+	// a read may complete several windows, the oldest must still be held
+	c.grow(window + readChunkSize)
+	return cursor{
+		window: window,
+		hop:    hop,
+		end:    c.history.Written() + int64(hop),
 	}
 }
 
-// StartStream begins the audio stream
+// Start begins the source and broadcasts frames to subscribers until it ends or the context exits.
+// Frames are stamped from the samples read since start, so sources played faster than
+// real time keep the spacing of their audio
 func (c *AudioStream) Start() (err error) {
-	// Reset output audio to zeros
-	if err = c.openStream(); err != nil {
+	if err = c.source.Start(); err != nil {
 		return err
 	}
-	// Prefill the buffer
-	for i := 0; i < sampleRate/c.slidingWindow-1; i++ {
-		_, err := c.GetFrame()
-		if err != nil {
-			return err
-		}
-	}
+	c.started = time.Now()
+	go c.broadcast()
 	return nil
 }
 
 // CloseStream stops the audio stream
 func (c *AudioStream) CloseStream() (err error) {
-	return c.closeStream()
+	return c.source.Close()
 }
 
-// GetFrame retrieves a 1-second audio frame with sliding window
+// GetFrame reads until the next hop and returns the window of history ending with it,
+// windows before the history fills start with silence. It reads the source itself
+// so it cannot be used once the stream is started
 func (c *AudioStream) GetFrame() ([]float32, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	// Get next audio frame
-	frames, err := c.getNextFrame()
-	if err != nil {
-		return nil, err
-	}
-	// Slide the window
-	var pcm = make([]float32, c.windowSize)
-	// When opening a stream with a single-channel float input on PortAudio,
-	// the input buffer is already a float32 slice
-	copy(pcm[c.windowSize-c.slidingWindow:], (*[1 << 30]float32)(unsafe.Pointer(&frames[0]))[:c.slidingWindow:c.slidingWindow])
-	return pcm, nil
-}
-
-// SimpleMicStream implements a microphone audio stream
-type MicStream struct {
-	*AudioStream
-	stream          *portaudio.Stream
-	framesPerBuffer int
-	subscribers     []chan []float32
-	subscribersMu   sync.RWMutex
-}
-
-// NewMicStream creates a new microphone audio stream
-func NewMicStream(ctx state.Context, windowLengthSecs, slidingWindowSecs float32) (*MicStream, error) {
-	// Initialize PortAudio
-	if err := portaudio.Initialize(); err != nil {
-		return nil, fmt.Errorf("portaudio.Initialize: %w", err)
-	}
-	// Calculate chunk size
-	chunkSize := round(slidingWindowSecs * float32(sampleRate))
-	fmt.Println("chunk size:", chunkSize)
-
-	deviceInfo, err := portaudio.DefaultInputDevice()
-	if err != nil {
-		return nil, fmt.Errorf("portaudio.DefaultInputDevice: %w", err)
-	}
-	inputParams := portaudio.LowLatencyParameters(deviceInfo, nil)
-	inputParams.Input.Channels = 1
-	inputParams.Output.Channels = 0
-	inputParams.SampleRate = float64(sampleRate)
-	inputParams.FramesPerBuffer = chunkSize
-
-	var stream *portaudio.Stream
-	var buffer = make([]float32, chunkSize)
-	stream, err = portaudio.OpenStream(inputParams, buffer)
-	if err != nil {
-		return nil, fmt.Errorf("portaudio.OpenStream: %w", err)
-	}
-	go ctx.Defer(func() {
-		fmt.Println("portaudio exiting")
-		if err = stream.Stop(); err != nil {
-			fmt.Printf("failed to stop audio stream: %s\n", err)
-		}
-		if err = stream.Close(); err != nil {
-			fmt.Printf("failed to close audio stream: %s\n", err)
-		}
-		if err = portaudio.Terminate(); err != nil {
-			fmt.Printf("failed to terminate portaudio: %s\n", err)
+	for !c.cursor.due(c.history.Written(), c.ended) {
+		if c.ended {
+			return nil, io.EOF
 		}
-	})
-	var micStream = &MicStream{
-		AudioStream: NewAudioStream(
-			stream.Start,
-			stream.Stop,
-			func() ([]float32, error) {
-				return buffer, stream.Read()
-			},
-			windowLengthSecs,
-			slidingWindowSecs,
-		),
-		subscribers:     make([]chan []float32, 0),
-		framesPerBuffer: chunkSize,
-		stream:          stream,
-	}
-	go micStream.broadcast(ctx)
-	return micStream, nil
-}
-
-// Subscribe creates a new channel for receiving audio frames
-func (s *MicStream) Subscribe() <-chan []float32 {
-	s.subscribersMu.Lock()
-	defer s.subscribersMu.Unlock()
-
-	var ch = make(chan []float32, 10) // Buffered channel to prevent blocking
-	s.subscribers = append(s.subscribers, ch)
-	return ch
-}
-
-// Unsubscribe removes a specific subscriber channel
-func (s *MicStream) Unsubscribe(ch <-chan []float32) {
-	s.subscribersMu.Lock()
-	defer s.subscribersMu.Unlock()
+		// Get next audio frame
+		frames, err := c.getNextFrame()
+		if errors.Is(err, io.EOF) {
+			c.ended = true
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.write(frames)
+	}
+	return c.cut(&c.cursor).Samples, nil
+}
 
+// grow keeps at least size samples of every channel
+func (c *AudioStream) grow(size int) {
+	c.history.Grow(size)
+	for _, channel := range c.channels {
+		channel.Grow(size)
+	}
+}
+
+// write appends a chunk of every channel to the history
+func (c *AudioStream) write(frames [][]float32) {
+	if len(frames) == 0 {
+		return
+	}
+	c.history.Write(mix(frames))
+	for i, channel := range c.channels {
+		channel.Write(frames[i])
+	}
+}
+
+// cut returns the window ending at the cursor and advances it by a hop
+func (c *AudioStream) cut(cur *cursor) Frame {
+	var pcm = make([]float32, cur.window)
+	c.history.Read(pcm, cur.end)
+	var frame = Frame{
+		Samples: pcm,
+		Time:    c.started.Add(samplesDuration(cur.end)),
+		Seq:     cur.seq,
+		End:     cur.end,
+	}
+	if c.channels != nil {
+		frame.Channels = make([][]float32, len(c.channels))
+		for i, channel := range c.channels {
+			frame.Channels[i] = make([]float32, cur.window)
+			channel.Read(frame.Channels[i], cur.end)
+		}
+	}
+	cur.end += int64(cur.hop)
+	cur.seq++
+	return frame
+}
+
+// Subscribe creates a new channel receiving windows of the given length every hop,
+// starting one hop from now
+func (s *AudioStream) Subscribe(opts SubscribeOptions) <-chan Frame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultBlockTimeout
+	}
+	var sub = &subscriber{
+		ch:           make(chan Frame, 10), // Buffered channel to prevent blocking
+		backpressure: opts.Backpressure,
+		timeout:      opts.Timeout,
+		cursor:       s.newCursor(opts),
+	}
+	s.subscribers = append(s.subscribers, sub)
+	return sub.ch
+}
+
+// OnError registers a callback for capture errors, which no longer stop the stream when the
+// source can be reopened. Without callbacks errors are printed
+func (s *AudioStream) OnError(fn func(error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers = append(s.handlers, fn)
+}
+
+func (s *AudioStream) report(err error) {
+	s.mu.Lock()
+	var handlers = append([]func(error){}, s.handlers...)
+	s.mu.Unlock()
+	if len(handlers) == 0 {
+		fmt.Printf("audio stream: %s\n", err)
+	}
+	for _, fn := range handlers {
+		fn(err)
+	}
+}
+
+// reopen reports a failed read and reopens the source with exponential backoff, keeping
+// subscribers. It returns false when the source cannot be reopened or the context exits
+func (s *AudioStream) reopen(err error) bool {
+	s.report(fmt.Errorf("audio source failed: %w", err))
+	source, ok := s.source.(reopener)
+	if !ok {
+		return false
+	}
+	for attempt, backoff := 1, s.minBackoff; ; attempt++ {
+		select {
+		case <-s.ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		if err := source.Reopen(); err != nil {
+			s.report(fmt.Errorf("reopening audio source, attempt %d: %w", attempt, err))
+			backoff = min(2*backoff, s.maxBackoff)
+			continue
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// the reopened source may run at another rate
+		s.getNextFrame = chunks(s.source)
+		// audio lost while reopening is skipped, frame times follow the wall clock again
+		s.started = time.Now().Add(-samplesDuration(s.history.Written()))
+		return true
+	}
+}
+
+// PreRoll keeps at least secs of audio before the newest window, so clips can start
+// before the window that triggered them
+func (s *AudioStream) PreRoll(secs float32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.grow(int(secs*float32(SampleRate)) + s.cursor.window + readChunkSize)
+}
+
+// Clip returns a channel receiving a single frame holding the audio from preRollSecs before
+// the stream position at, e.g. a window's End, until postRollSecs after it, then closing.
+// Audio older than the PreRoll is silence
+func (s *AudioStream) Clip(at int64, preRollSecs, postRollSecs float32) <-chan Frame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		preRoll  = int(preRollSecs * float32(SampleRate))
+		postRoll = int(postRollSecs * float32(SampleRate))
+		end      = at + int64(postRoll)
+	)
+	s.grow(preRoll + postRoll + readChunkSize)
+	var sub = &subscriber{
+		ch:           make(chan Frame, 1),
+		backpressure: DropNewest,
+		once:         true,
+		// the hop only matters to tell when the stream ended
+		cursor: cursor{window: preRoll + postRoll, hop: preRoll + postRoll, end: end},
+	}
+	if s.ended {
+		sub.ch <- s.cut(&sub.cursor)
+		close(sub.ch)
+		return sub.ch
+	}
+	s.subscribers = append(s.subscribers, sub)
+	return sub.ch
+}
+
+// Position returns the number of samples at the model rate captured so far
+func (s *AudioStream) Position() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.history.Written()
+}
+
+// Stats returns the counters of a subscriber, false once it unsubscribed
+func (s *AudioStream) Stats(ch <-chan Frame) (SubscriberStats, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sub := range s.subscribers {
+		if sub.ch == ch {
+			return sub.stats(), true
+		}
+	}
+	return SubscriberStats{}, false
+}
+
+// overflowCounter is implemented by sources that lose input when they are not read in time
+type overflowCounter interface {
+	Overflows() uint64
+}
+
+// Overflows returns how often the source lost input because the stream fell behind
+func (s *AudioStream) Overflows() uint64 {
+	if counter, ok := s.source.(overflowCounter); ok {
+		return counter.Overflows()
+	}
+	return 0
+}
+
+// Unsubscribe removes a specific subscriber channel, a Block subscriber's pending
+// send may delay it by up to its timeout
+func (s *AudioStream) Unsubscribe(ch <-chan Frame) {
+	s.mu.Lock()
+	var removed *subscriber
 	for i, subscriber := range s.subscribers {
-		if subscriber == ch {
-			close(subscriber)
+		if subscriber.ch == ch {
+			removed = subscriber
 			// Remove the channel from the slice
 			s.subscribers = append(s.subscribers[:i], s.subscribers[i+1:]...)
 			break
 		}
 	}
+	s.mu.Unlock()
+	// closed outside of the stream's lock, which a pending send must not hold up
+	if removed != nil {
+		removed.close()
+	}
 }
 
-// broadcast continuously reads audio frames and sends them to all subscribers
-func (s *MicStream) broadcast(ctx state.Context) {
+// broadcast continuously reads audio into the history and sends every due window
+// to its subscriber, subscriber channels are closed when the source ends or fails for good
+func (s *AudioStream) broadcast() {
+	defer s.closeSubscribers()
 	for {
 		select {
-		case <-ctx.Done():
+		case <-s.ctx.Done():
 			return
 		default:
 			// Read audio frame
-			frame, err := s.GetFrame()
-			if err != nil {
-				panic(fmt.Errorf("micStream.GetFrame: %w", err))
+			frames, err := s.getNextFrame()
+			var ended = errors.Is(err, io.EOF)
+			if err != nil && !ended {
+				if s.reopen(err) {
+					continue
+				}
+				ended = true
 			}
-			// Broadcast to all subscribers
-			s.subscribersMu.RLock()
-			for _, ch := range s.subscribers {
-				select {
-				case ch <- append([]float32(nil), frame...):
-				default:
-					// Skip if channel is full to prevent blocking
+			s.mu.Lock()
+			s.write(frames)
+			s.ended = ended
+			// cut the due windows of all subscribers, once subscribers leave with theirs
+			var (
+				subscribers = s.subscribers[:0]
+				targets     = make([]*subscriber, len(s.subscribers))
+				due         = make([][]Frame, len(s.subscribers))
+			)
+			for i, sub := range s.subscribers {
+				targets[i] = sub
+				for sub.due(s.history.Written(), ended) && (!sub.once || len(due[i]) == 0) {
+					due[i] = append(due[i], s.cut(&sub.cursor))
 				}
+				if !sub.once || len(due[i]) == 0 {
+					subscribers = append(subscribers, sub)
+				}
+			}
+			s.subscribers = subscribers
+			s.mu.Unlock()
+			for i, frames := range due {
+				if len(frames) > 0 {
+					targets[i].deliver(frames)
+				}
+			}
+			if ended {
+				return
 			}
-			s.subscribersMu.RUnlock()
 		}
 	}
 }
 
-func round(f float32) int {
-	if f < 0 {
-		return int(f - 0.5)
+// closeSubscribers closes every channel, subscribers stay listed so their stats remain readable
+func (s *AudioStream) closeSubscribers() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sub := range s.subscribers {
+		sub.close()
 	}
-	return int(f + 0.5)
 }
@@ -0,0 +1,352 @@
+package audio
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/algo-boyz/snowgirl/pkg/state"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAudioStreamWindows(t *testing.T) {
+	// a ramp at the model rate shows where every window sample came from
+	const (
+		window = 400
+		hop    = 100
+	)
+	var (
+		signal = ramp(1, 1001)
+		chunks = [][]float32{signal[:30], signal[30:250], signal[250:]}
+		read   int
+	)
+	var source = &fakeSource{read: func() ([]float32, error) {
+		read++
+		if read > len(chunks) {
+			return nil, io.EOF
+		}
+		return chunks[read-1], nil
+	}}
+	var stream = NewAudioStream(state.NewContext(), source, float32(window)/SampleRate, float32(hop)/SampleRate)
+	for i := 1; i <= 10; i++ {
+		frame, err := stream.GetFrame()
+		require.NoError(t, err)
+		// the window ends with sample i*hop and holds the window before it
+		var want = ramp(i*hop-window+1, i*hop+1)
+		if i*hop < window {
+			want = append(make([]float32, window-i*hop), ramp(1, i*hop+1)...)
+		}
+		require.Equal(t, want, frame, "window %d", i)
+	}
+	_, err := stream.GetFrame()
+	require.ErrorIs(t, err, io.EOF)
+}
+
+// fakeSource is a model rate source reading from a function
+type fakeSource struct {
+	read func() ([]float32, error)
+}
+
+func (f *fakeSource) Start() error             { return nil }
+func (f *fakeSource) Read() ([]float32, error) { return f.read() }
+func (f *fakeSource) SampleRate() int          { return SampleRate }
+func (f *fakeSource) Close() error             { return nil }
+
+func TestAudioStreamSubscribers(t *testing.T) {
+	// a VAD sized and a hotword sized subscriber cut from the same second of ramp
+	var (
+		pcm    = &PCM{Samples: ramp(1, 16001), SampleRate: SampleRate, Channels: 1}
+		stream = NewAudioStream(state.NewContext(), NewPCMSource(pcm, 20), 0.25, 0.125)
+		tests  = []struct {
+			opts        SubscribeOptions
+			window, hop int
+			count       int
+		}{
+			// the last 32ms window is padded past the end of the source
+			{SubscribeOptions{WindowSecs: 0.032, HopSecs: 0.032}, 512, 512, 32},
+			{SubscribeOptions{}, 4000, 2000, 8},
+		}
+		frames = make([][]Frame, len(tests))
+		wg     sync.WaitGroup
+	)
+	for i, tc := range tests {
+		ch := stream.Subscribe(tc.opts)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for frame := range ch {
+				frames[i] = append(frames[i], frame)
+			}
+		}()
+	}
+	require.NoError(t, stream.Start())
+	wg.Wait()
+	for i, tc := range tests {
+		require.Len(t, frames[i], tc.count, "subscriber %d", i)
+		for k, frame := range frames[i] {
+			// position p holds p+1, positions outside the source are silence
+			var (
+				end  = (k + 1) * tc.hop
+				want = make([]float32, tc.window)
+			)
+			for j := range want {
+				if p := end - tc.window + j; p >= 0 && p < len(pcm.Samples) {
+					want[j] = float32(p + 1)
+				}
+			}
+			require.Equal(t, want, frame.Samples, "subscriber %d window %d", i, k)
+		}
+	}
+}
+
+func TestAudioStreamLongRunning(t *testing.T) {
+	var stream = NewAudioStream(state.NewContext(), &fakeSource{}, 0.01, 0.01)
+	stream.started = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// about 12 days into the stream, nanoseconds times the rate would have overflowed
+	var frame = stream.cut(&cursor{window: 160, hop: 160, end: 1<<34 + 8})
+	require.Equal(t, stream.started.Add(1073741824500*time.Microsecond), frame.Time)
+	require.Equal(t, frame.Time.Add(-10*time.Millisecond), frame.Start())
+}
+
+func TestAudioStreamClip(t *testing.T) {
+	const (
+		preRoll  = 8000
+		postRoll = 4000
+	)
+	var (
+		pcm    = &PCM{Samples: ramp(1, 32001), SampleRate: SampleRate, Channels: 1}
+		stream = NewAudioStream(state.NewContext(), NewPCMSource(pcm, 10), 0.25, 0.125)
+		frames = stream.Subscribe(SubscribeOptions{})
+		clips  []<-chan Frame
+	)
+	// keep more than the clip needs, so a slow reader still finds its pre-roll
+	stream.PreRoll(1.5)
+	require.NoError(t, stream.Start())
+	for frame := range frames {
+		// clip around the windows ending at 0.75s and at the last sample, the first
+		// starts before the stream and the second ends after it
+		if frame.Seq == 5 {
+			// a reopen moves the clock by the outage, clips follow stream positions
+			stream.mu.Lock()
+			stream.started = stream.started.Add(time.Hour)
+			stream.mu.Unlock()
+		}
+		if frame.Seq == 5 || frame.Seq == 15 {
+			clips = append(clips, stream.Clip(frame.End, float32(preRoll)/SampleRate, float32(postRoll)/SampleRate))
+		}
+	}
+	require.Len(t, clips, 2)
+	for i, end := range []int{12000, 32000} {
+		clip, ok := <-clips[i]
+		require.True(t, ok, "clip %d", i)
+		require.Equal(t, end+postRoll, int(clip.Time.Sub(stream.started)*SampleRate/time.Second), "clip %d", i)
+		var want = make([]float32, preRoll+postRoll)
+		for j := range want {
+			if p := end - preRoll + j; p >= 0 && p < len(pcm.Samples) {
+				want[j] = float32(p + 1)
+			}
+		}
+		require.Equal(t, want, clip.Samples, "clip %d", i)
+		_, ok = <-clips[i]
+		require.False(t, ok, "clip %d is closed after one frame", i)
+	}
+}
+
+// overflowingSource is a fakeSource reporting input overflows
+type overflowingSource struct {
+	fakeSource
+	overflows uint64
+}
+
+func (o *overflowingSource) Overflows() uint64 { return o.overflows }
+
+func TestAudioStreamBackpressure(t *testing.T) {
+	const windows = 15
+	for _, tc := range []struct {
+		name      string
+		opts      SubscribeOptions
+		delivered []uint64
+		dropped   uint64
+	}{
+		{"drop newest", SubscribeOptions{Backpressure: DropNewest}, seqs(0, 10), 5},
+		{"drop oldest", SubscribeOptions{Backpressure: DropOldest}, seqs(5, 15), 5},
+		{"block", SubscribeOptions{Backpressure: Block, Timeout: 5 * time.Millisecond}, seqs(0, 10), 5},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				read   int
+				source = &overflowingSource{overflows: 3}
+			)
+			source.read = func() ([]float32, error) {
+				if read++; read > windows {
+					return nil, io.EOF
+				}
+				return ramp(0, 100), nil
+			}
+			var stream = NewAudioStream(state.NewContext(), source, float32(100)/SampleRate, float32(100)/SampleRate)
+			frames := stream.Subscribe(tc.opts)
+			var start = time.Now()
+			require.NoError(t, stream.Start())
+			// the subscriber reads nothing until the source ended
+			require.Eventually(t, func() bool {
+				stats, _ := stream.Stats(frames)
+				return stats.Delivered+stats.Dropped == windows
+			}, time.Second, time.Millisecond)
+			if tc.opts.Backpressure == Block {
+				require.GreaterOrEqual(t, time.Since(start), 5*5*time.Millisecond, "expected every drop to wait for the timeout")
+			}
+			var received []uint64
+			for frame := range frames {
+				received = append(received, frame.Seq)
+			}
+			require.Equal(t, tc.delivered, received)
+			stats, ok := stream.Stats(frames)
+			require.True(t, ok)
+			require.Equal(t, SubscriberStats{Delivered: 10, Dropped: tc.dropped}, stats)
+			require.EqualValues(t, 3, stream.Overflows())
+
+			stream.Unsubscribe(frames)
+			_, ok = stream.Stats(frames)
+			require.False(t, ok)
+		})
+	}
+}
+
+func TestAudioStreamBlockedSubscriber(t *testing.T) {
+	var (
+		read   int
+		source = &fakeSource{}
+	)
+	source.read = func() ([]float32, error) {
+		if read++; read > 15 {
+			return nil, io.EOF
+		}
+		return ramp(0, 100), nil
+	}
+	var (
+		stream  = NewAudioStream(state.NewContext(), source, float32(100)/SampleRate, float32(100)/SampleRate)
+		blocked = stream.Subscribe(SubscribeOptions{Backpressure: Block, Timeout: time.Hour})
+		other   = stream.Subscribe(SubscribeOptions{})
+	)
+	require.NoError(t, stream.Start())
+	// the unread subscriber fills its channel and stalls the stream on its next window
+	require.Eventually(t, func() bool {
+		stats, _ := stream.Stats(blocked)
+		return stats.Delivered == 10
+	}, time.Second, time.Millisecond)
+	// the stream's lock is free while it waits
+	var done = make(chan struct{})
+	go func() {
+		defer close(done)
+		stream.Unsubscribe(stream.Subscribe(SubscribeOptions{}))
+		stream.Unsubscribe(other)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a blocked send holds the stream's lock")
+	}
+	for range blocked {
+	}
+}
+
+func seqs(from, to uint64) []uint64 {
+	var s []uint64
+	for i := from; i < to; i++ {
+		s = append(s, i)
+	}
+	return s
+}
+
+var (
+	errUnplugged = errors.New("device unplugged")
+	errNotFound  = errors.New("device not found")
+)
+
+// flakySource loses its device after failAfter reads and finds it again on the
+// third reopen, it ends after total reads
+type flakySource struct {
+	fakeSource
+	reads, failAfter, total int
+	lost                    bool
+	reopens                 int
+}
+
+func (f *flakySource) Read() ([]float32, error) {
+	if f.lost {
+		return nil, errUnplugged
+	}
+	if f.reads == f.failAfter && f.reopens == 0 {
+		f.lost = true
+		return nil, errUnplugged
+	}
+	if f.reads++; f.reads > f.total {
+		return nil, io.EOF
+	}
+	return ramp(0, 1600), nil
+}
+
+func (f *flakySource) Reopen() error {
+	if f.reopens++; f.reopens < 3 {
+		return errNotFound
+	}
+	f.lost = false
+	return nil
+}
+
+func TestAudioStreamReopen(t *testing.T) {
+	var (
+		source = &flakySource{failAfter: 3, total: 6}
+		stream = NewAudioStream(state.NewContext(), source, 0.1, 0.1)
+		errs   []error
+	)
+	stream.minBackoff, stream.maxBackoff = time.Millisecond, 2*time.Millisecond
+	stream.OnError(func(err error) {
+		errs = append(errs, err)
+	})
+	frames := stream.Subscribe(SubscribeOptions{Backpressure: Block})
+	require.NoError(t, stream.Start())
+	var received []uint64
+	for frame := range frames {
+		received = append(received, frame.Seq)
+	}
+	require.Equal(t, seqs(0, 6), received, "expected the subscriber to survive the lost device")
+	require.Len(t, errs, 3)
+	require.ErrorIs(t, errs[0], errUnplugged)
+	require.ErrorIs(t, errs[1], errNotFound)
+	require.ErrorIs(t, errs[2], errNotFound)
+	require.Equal(t, 3, source.reopens)
+}
+
+func TestAudioStreamReopenLongRunning(t *testing.T) {
+	var (
+		source = &flakySource{lost: true, reopens: 2}
+		stream = NewAudioStream(state.NewContext(), source, 0.1, 0.1)
+	)
+	stream.minBackoff = time.Millisecond
+	stream.OnError(func(error) {})
+	// about 12 days of audio were captured before the device was lost
+	stream.history.written = 1 << 34
+	require.True(t, stream.reopen(errUnplugged))
+	require.WithinDuration(t, time.Now().Add(-samplesDuration(1<<34)), stream.started, time.Second)
+	require.Greater(t, time.Since(stream.started), 12*24*time.Hour)
+}
+
+func TestAudioStreamSourceError(t *testing.T) {
+	// sources that cannot be reopened end the stream instead of panicking
+	var (
+		source = &fakeSource{read: func() ([]float32, error) { return nil, errUnplugged }}
+		stream = NewAudioStream(state.NewContext(), source, 0.1, 0.1)
+		errs   = make(chan error, 1)
+	)
+	stream.OnError(func(err error) {
+		errs <- err
+	})
+	frames := stream.Subscribe(SubscribeOptions{})
+	require.NoError(t, stream.Start())
+	_, ok := <-frames
+	require.False(t, ok, "expected the channel to close")
+	require.ErrorIs(t, <-errs, errUnplugged)
+}
@@ -0,0 +1,122 @@
+package audio
+
+import (
+	"math"
+	"slices"
+)
+
+// ChannelSource is implemented by sources capturing several channels,
+// their Read returns interleaved frames of Channels samples
+type ChannelSource interface {
+	Channels() int
+}
+
+func sourceChannels(source AudioSource) int {
+	if s, ok := source.(ChannelSource); ok {
+		return max(1, s.Channels())
+	}
+	return 1
+}
+
+// channelReaders splits an interleaved reader into one reader per channel. A channel
+// without pending samples reads the next chunk for all of them, so they must be read
+// equally and errors are returned to every channel once reached
+func channelReaders(read func() ([]float32, error), channels int) []func() ([]float32, error) {
+	if channels == 1 {
+		return []func() ([]float32, error){read}
+	}
+	var (
+		pending = make([][]float32, channels)
+		failed  error
+		readers = make([]func() ([]float32, error), channels)
+	)
+	for c := range readers {
+		readers[c] = func() ([]float32, error) {
+			if len(pending[c]) == 0 {
+				if failed != nil {
+					return nil, failed
+				}
+				samples, err := read()
+				if err != nil {
+					failed = err
+					return nil, err
+				}
+				for i, channel := range deinterleave(samples, channels) {
+					pending[i] = append(pending[i], channel...)
+				}
+			}
+			var chunk = pending[c]
+			pending[c] = nil
+			return chunk, nil
+		}
+	}
+	return readers
+}
+
+// deinterleave splits frames of interleaved samples into channels, dropping a partial frame
+func deinterleave(samples []float32, channels int) [][]float32 {
+	var split = make([][]float32, channels)
+	for c := range split {
+		split[c] = make([]float32, len(samples)/channels)
+		for i := range split[c] {
+			split[c][i] = samples[i*channels+c]
+		}
+	}
+	return split
+}
+
+// mix averages equally long channels
+func mix(channels [][]float32) []float32 {
+	if len(channels) == 1 {
+		return channels[0]
+	}
+	var mixed = make([]float32, len(channels[0]))
+	for _, channel := range channels {
+		for i, s := range channel {
+			mixed[i] += s / float32(len(channels))
+		}
+	}
+	return mixed
+}
+
+// snrBlockSize is the 20ms of samples whose energies SNR compares
+const snrBlockSize = SampleRate / 50
+
+// SNR estimates the signal to noise ratio of a window in dB from the energy of its loudest
+// and quietest fifth of 20ms blocks, a window shorter than 5 blocks has none
+func SNR(samples []float32) float64 {
+	var energies = make([]float64, len(samples)/snrBlockSize)
+	if len(energies) < 5 {
+		return 0
+	}
+	for i := range energies {
+		for _, s := range samples[i*snrBlockSize : (i+1)*snrBlockSize] {
+			energies[i] += float64(s) * float64(s)
+		}
+	}
+	slices.Sort(energies)
+	var (
+		fifth         = len(energies) / 5
+		noise, signal float64
+	)
+	for i := range fifth {
+		noise += energies[i]
+		signal += energies[len(energies)-1-i]
+	}
+	const floor = 1e-10
+	return 10 * math.Log10((signal+floor)/(noise+floor))
+}
+
+// BestSNR returns the index of the channel with the highest signal to noise ratio
+func BestSNR(channels [][]float32) int {
+	var (
+		best    int
+		bestSNR = math.Inf(-1)
+	)
+	for c, channel := range channels {
+		if snr := SNR(channel); snr > bestSNR {
+			best, bestSNR = c, snr
+		}
+	}
+	return best
+}
@@ -0,0 +1,114 @@
+package audio
+
+import (
+	"io"
+	"math"
+	"testing"
+
+	"github.com/algo-boyz/snowgirl/pkg/state"
+	"github.com/stretchr/testify/require"
+)
+
+// channelSource is a fakeSource of interleaved channels at any rate
+type channelSource struct {
+	fakeSource
+	channels int
+	rate     int
+}
+
+func (c *channelSource) Channels() int   { return c.channels }
+func (c *channelSource) SampleRate() int { return c.rate }
+
+// interleave reads the channels as one interleaved source in chunks of the given frames
+func interleave(channels [][]float32, rate, chunk int) *channelSource {
+	var (
+		source = &channelSource{channels: len(channels), rate: rate}
+		pos    int
+	)
+	source.read = func() ([]float32, error) {
+		if pos >= len(channels[0]) {
+			return nil, io.EOF
+		}
+		var samples []float32
+		for ; pos < len(channels[0]) && len(samples) < chunk*len(channels); pos++ {
+			for _, channel := range channels {
+				samples = append(samples, channel[pos])
+			}
+		}
+		return samples, nil
+	}
+	return source
+}
+
+func TestAudioStreamChannels(t *testing.T) {
+	const window, hop = 400, 200
+	var (
+		first  = ramp(1, 1001)
+		second = make([]float32, len(first))
+	)
+	for i := range second {
+		second[i] = -3 * first[i]
+	}
+	var stream = NewAudioStream(state.NewContext(), interleave([][]float32{first, second}, SampleRate, 250), float32(window)/SampleRate, float32(hop)/SampleRate)
+	frames := stream.Subscribe(SubscribeOptions{})
+	require.NoError(t, stream.Start())
+	var count int
+	for frame := range frames {
+		require.Len(t, frame.Channels, 2)
+		var end = (count + 1) * hop
+		for i := range window {
+			var p = end - window + i
+			if p < 0 {
+				continue
+			}
+			require.Equal(t, first[p], frame.Channels[0][i], "window %d channel 0 sample %d", count, i)
+			require.Equal(t, second[p], frame.Channels[1][i], "window %d channel 1 sample %d", count, i)
+			require.Equal(t, -first[p], frame.Samples[i], "window %d mix sample %d", count, i)
+		}
+		count++
+	}
+	require.Equal(t, 5, count)
+}
+
+func TestAudioStreamChannelsResampled(t *testing.T) {
+	// channels resampled from 48kHz stay aligned
+	var channels = [][]float32{make([]float32, 4800), make([]float32, 4800), make([]float32, 4800)}
+	for i := range channels[0] {
+		channels[0][i] = float32(math.Sin(float64(i) / 20))
+		channels[1][i] = channels[0][i] / 2
+		channels[2][i] = -channels[0][i]
+	}
+	var stream = NewAudioStream(state.NewContext(), interleave(channels, 48000, 1000), 0.05, 0.05)
+	frames := stream.Subscribe(SubscribeOptions{})
+	require.NoError(t, stream.Start())
+	var count int
+	for frame := range frames {
+		require.Len(t, frame.Channels, 3)
+		for i, s := range frame.Channels[0] {
+			require.InDelta(t, s/2, frame.Channels[1][i], 1e-5)
+			require.InDelta(t, -s, frame.Channels[2][i], 1e-5)
+			require.InDelta(t, s/6, frame.Samples[i], 1e-5)
+		}
+		count++
+	}
+	require.Equal(t, 2, count)
+}
+
+func TestBestSNR(t *testing.T) {
+	// a burst over quiet noise on the second channel, steady noise on the first
+	var (
+		noise  = make([]float32, 16000)
+		speech = make([]float32, 16000)
+	)
+	for i := range noise {
+		noise[i] = 0.1 * float32(math.Sin(float64(i)*1.7))
+		speech[i] = 0.01 * float32(math.Sin(float64(i)*1.3))
+		if i >= 6000 && i < 10000 {
+			speech[i] = 0.5 * float32(math.Sin(float64(i)/5))
+		}
+	}
+	require.InDelta(t, 0, SNR(noise), 0.5)
+	require.Greater(t, SNR(speech), 30.0)
+	require.Equal(t, 1, BestSNR([][]float32{noise, speech}))
+	require.Zero(t, SNR(make([]float32, 100)), "a window shorter than five blocks")
+}
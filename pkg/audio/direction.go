@@ -0,0 +1,190 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"strconv"
+	"strings"
+
+	"github.com/mjibson/go-dsp/fft"
+)
+
+// speedOfSound in air at room temperature in m/s
+const speedOfSound = 343.0
+
+// Mic is the position of an array microphone in metres
+type Mic struct {
+	X, Y float64
+}
+
+// ArrayGeometry places the mics of an array in channel order on a plane, azimuths are
+// measured counterclockwise from its x axis
+type ArrayGeometry []Mic
+
+// CircularArray places n mics evenly on a circle, the first on the x axis.
+// Fewer than 2 mics give an array that fails Validate
+func CircularArray(n int, radius float64) ArrayGeometry {
+	var array = make(ArrayGeometry, max(n, 0))
+	for i := range array {
+		var angle = 2 * math.Pi * float64(i) / float64(n)
+		array[i] = Mic{X: radius * math.Cos(angle), Y: radius * math.Sin(angle)}
+	}
+	return array
+}
+
+// ParseArrayGeometry reads mic positions in metres written as x,y;x,y;... or a
+// circular array written as circular:mics:radius, e.g. circular:4:0.032
+func ParseArrayGeometry(s string) (ArrayGeometry, error) {
+	if spec, ok := strings.CutPrefix(s, "circular:"); ok {
+		n, radius, ok := strings.Cut(spec, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid circular array %q, expected circular:mics:radius", s)
+		}
+		mics, err := strconv.Atoi(n)
+		if err != nil {
+			return nil, fmt.Errorf("invalid circular array mic count %q: %w", n, err)
+		}
+		if mics < 2 {
+			return nil, fmt.Errorf("invalid circular array mic count %d, an array needs at least 2 mics", mics)
+		}
+		r, err := strconv.ParseFloat(radius, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid circular array radius %q: %w", radius, err)
+		}
+		var array = CircularArray(mics, r)
+		return array, array.Validate()
+	}
+	var array ArrayGeometry
+	for _, position := range strings.Split(s, ";") {
+		x, y, ok := strings.Cut(position, ",")
+		if !ok {
+			return nil, fmt.Errorf("invalid mic position %q, expected x,y", position)
+		}
+		var (
+			mic Mic
+			err error
+		)
+		if mic.X, err = strconv.ParseFloat(strings.TrimSpace(x), 64); err != nil {
+			return nil, fmt.Errorf("invalid mic position %q: %w", position, err)
+		}
+		if mic.Y, err = strconv.ParseFloat(strings.TrimSpace(y), 64); err != nil {
+			return nil, fmt.Errorf("invalid mic position %q: %w", position, err)
+		}
+		array = append(array, mic)
+	}
+	return array, array.Validate()
+}
+
+// Validate checks the array has at least two mics apart from each other
+func (g ArrayGeometry) Validate() error {
+	if len(g) < 2 {
+		return fmt.Errorf("an array needs at least 2 mics, got %d", len(g))
+	}
+	if g.aperture() == 0 {
+		return fmt.Errorf("array mics are all at the same position")
+	}
+	return nil
+}
+
+// aperture is the largest distance between two mics
+func (g ArrayGeometry) aperture() float64 {
+	var widest float64
+	for i := range g {
+		for j := i + 1; j < len(g); j++ {
+			widest = max(widest, math.Hypot(g[i].X-g[j].X, g[i].Y-g[j].Y))
+		}
+	}
+	return widest
+}
+
+// Azimuth estimates the direction of a sound in degrees in [0, 360) from the delays between
+// every pair of channels, captured by the mics of the array at the given rate. It picks the
+// far field direction whose expected delays fit the measured ones best, so linear arrays
+// cannot tell the two sides of their axis apart
+func (g ArrayGeometry) Azimuth(channels [][]float32, rate int) (float64, error) {
+	if len(channels) != len(g) {
+		return 0, fmt.Errorf("array of %d mics cannot locate %d channels", len(g), len(channels))
+	}
+	// no pair can be further apart in time than sound takes to cross the array
+	var maxDelay = int(math.Ceil(g.aperture()/speedOfSound*float64(rate))) + 1
+	type pair struct {
+		i, j  int
+		delay float64 // metres travelled further to mic j than to mic i
+	}
+	var pairs []pair
+	for i := range g {
+		for j := i + 1; j < len(g); j++ {
+			var delay = GCCPHAT(channels[i], channels[j], maxDelay)
+			pairs = append(pairs, pair{i, j, delay / float64(rate) * speedOfSound})
+		}
+	}
+	var (
+		best      float64
+		bestError = math.Inf(1)
+	)
+	// a plane wave from direction u reaches mic i (p_i·u)/c earlier than the origin
+	for step := 0; step < 3600; step++ {
+		var (
+			azimuth  = float64(step) / 10
+			ux, uy   = math.Cos(azimuth * math.Pi / 180), math.Sin(azimuth * math.Pi / 180)
+			fitError float64
+		)
+		for _, p := range pairs {
+			var expected = (g[p.i].X-g[p.j].X)*ux + (g[p.i].Y-g[p.j].Y)*uy
+			fitError += (expected - p.delay) * (expected - p.delay)
+		}
+		if fitError < bestError {
+			best, bestError = azimuth, fitError
+		}
+	}
+	return best, nil
+}
+
+// GCCPHAT estimates how many samples b lags behind a by generalized cross correlation with
+// phase transform weighting, which whitens the spectrum so reverberant speech still gives a
+// sharp peak. Delays are searched up to maxDelay samples and refined between samples
+func GCCPHAT(a, b []float32, maxDelay int) float64 {
+	var size = 1
+	for size < len(a)+len(b) {
+		size *= 2
+	}
+	var spectrum = func(x []float32) []complex128 {
+		var padded = make([]float64, size)
+		for i, s := range x {
+			padded[i] = float64(s)
+		}
+		return fft.FFTReal(padded)
+	}
+	var (
+		fa    = spectrum(a)
+		fb    = spectrum(b)
+		cross = make([]complex128, size)
+	)
+	for k := range cross {
+		var c = fb[k] * cmplx.Conj(fa[k])
+		if magnitude := cmplx.Abs(c); magnitude > 1e-12 {
+			cross[k] = c / complex(magnitude, 0)
+		}
+	}
+	var (
+		correlation = fft.IFFT(cross)
+		at          = func(lag int) float64 { return real(correlation[(lag+size)%size]) }
+		peak        = 0
+	)
+	maxDelay = min(maxDelay, size/2-1)
+	for lag := -maxDelay; lag <= maxDelay; lag++ {
+		if at(lag) > at(peak) {
+			peak = lag
+		}
+	}
+	// fit a parabola through the peak and its neighbours
+	var (
+		left, centre, right = at(peak - 1), at(peak), at(peak + 1)
+		curvature           = left - 2*centre + right
+	)
+	if curvature >= 0 {
+		return float64(peak)
+	}
+	return float64(peak) + 0.5*(left-right)/curvature
+}
@@ -0,0 +1,90 @@
+package audio
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// broadband returns a signal sampled at any fractional delay in seconds, a sum of
+// sinusoids of random phase between 100Hz and 6kHz like voiced speech
+func broadband(seed int64) func(t float64) float32 {
+	var (
+		rng    = rand.New(rand.NewSource(seed))
+		freqs  = make([]float64, 60)
+		phases = make([]float64, len(freqs))
+	)
+	for i := range freqs {
+		freqs[i] = 100 + rng.Float64()*5900
+		phases[i] = rng.Float64() * 2 * math.Pi
+	}
+	return func(t float64) float32 {
+		var s float64
+		for i, f := range freqs {
+			s += math.Sin(2*math.Pi*f*t + phases[i])
+		}
+		return float32(s / float64(len(freqs)))
+	}
+}
+
+// delayed samples the signal arriving delay seconds late
+func delayed(signal func(float64) float32, delay float64, n int) []float32 {
+	var samples = make([]float32, n)
+	for i := range samples {
+		samples[i] = signal(float64(i)/SampleRate - delay)
+	}
+	return samples
+}
+
+func TestGCCPHAT(t *testing.T) {
+	var signal = broadband(1)
+	for _, delay := range []float64{0, 5, -3, 2.5, -0.4} {
+		var (
+			a = delayed(signal, 0, 4000)
+			b = delayed(signal, delay/SampleRate, 4000)
+		)
+		require.InDelta(t, delay, GCCPHAT(a, b, 10), 0.25, "delay %g", delay)
+	}
+}
+
+func TestArrayAzimuth(t *testing.T) {
+	var (
+		signal = broadband(2)
+		// a 4 mic array the size of common smart speaker boards
+		array = CircularArray(4, 0.045)
+	)
+	for _, azimuth := range []float64{0, 45, 130, 200, 270, 315} {
+		var (
+			ux, uy   = math.Cos(azimuth * math.Pi / 180), math.Sin(azimuth * math.Pi / 180)
+			channels = make([][]float32, len(array))
+		)
+		for i, mic := range array {
+			// mics nearer the source hear it earlier
+			channels[i] = delayed(signal, -(mic.X*ux+mic.Y*uy)/speedOfSound, 8000)
+		}
+		estimate, err := array.Azimuth(channels, SampleRate)
+		require.NoError(t, err)
+		var diff = math.Mod(estimate-azimuth+540, 360) - 180
+		require.InDelta(t, 0, diff, 5, "source at %g estimated at %g", azimuth, estimate)
+	}
+	_, err := array.Azimuth(make([][]float32, 2), SampleRate)
+	require.Error(t, err, "expected a channel count other than the mics to fail")
+}
+
+func TestParseArrayGeometry(t *testing.T) {
+	array, err := ParseArrayGeometry("circular:4:0.5")
+	require.NoError(t, err)
+	require.Len(t, array, 4)
+	require.InDelta(t, 0.5, array[1].Y, 1e-9)
+
+	array, err = ParseArrayGeometry("-0.05,0; 0.05,0")
+	require.NoError(t, err)
+	require.Equal(t, ArrayGeometry{{X: -0.05}, {X: 0.05}}, array)
+
+	for _, invalid := range []string{"0,0", "0,0;0,0", "1;2", "circular:4", "circular:-1:0.03", "circular:1:0.03", "circular:0:0.03", "a,b;1,2"} {
+		_, err = ParseArrayGeometry(invalid)
+		require.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,47 @@
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/mewkiz/flac"
+)
+
+// flacMaxPrealloc bounds the samples reserved up front from the header's sample count,
+// which a corrupt or hostile file may set near 2^36, longer files grow as frames arrive
+const flacMaxPrealloc = 1 << 22
+
+// decodeFLAC reads every frame of a FLAC stream, samples are scaled by their bit depth
+func decodeFLAC(r io.Reader) (*PCM, error) {
+	stream, err := flac.New(r)
+	if err != nil {
+		return nil, fmt.Errorf("error creating FLAC decoder: %w", err)
+	}
+	var (
+		channels = int(stream.Info.NChannels)
+		scale    = float32(int64(1) << (stream.Info.BitsPerSample - 1))
+		pcm      = &PCM{
+			Samples:    make([]float32, 0, min(stream.Info.NSamples*uint64(channels), flacMaxPrealloc)),
+			SampleRate: int(stream.Info.SampleRate),
+			Channels:   channels,
+		}
+	)
+	for {
+		frame, err := stream.ParseNext()
+		if errors.Is(err, io.EOF) {
+			return pcm, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading FLAC frame: %w", err)
+		}
+		if len(frame.Subframes) != channels {
+			return nil, fmt.Errorf("FLAC frame has %d channels, stream has %d", len(frame.Subframes), channels)
+		}
+		for i := 0; i < int(frame.BlockSize); i++ {
+			for _, subframe := range frame.Subframes {
+				pcm.Samples = append(pcm.Samples, float32(subframe.Samples[i])/scale)
+			}
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
+	"github.com/stretchr/testify/require"
+)
+
+// oggPage builds the first page of an Ogg stream holding a single packet
+func oggPage(packet string) []byte {
+	var page = []byte("OggS\x00\x02")
+	page = append(page, make([]byte, 20)...)
+	return append(append(page, 1, byte(len(packet))), packet...)
+}
+
+func TestSniff(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		head []byte
+		want Format
+	}{
+		{"wav", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), FormatWAV},
+		{"flac", []byte("fLaC\x00\x00\x00\x22"), FormatFLAC},
+		{"vorbis", oggPage("\x01vorbis\x00\x00\x00\x00"), FormatVorbis},
+		{"opus", oggPage("OpusHead\x01\x01"), FormatOpus},
+		{"mp3 with id3", []byte("ID3\x03\x00"), FormatMP3},
+		{"mp3 frame sync", []byte{0xFF, 0xF3, 0x84, 0xC4}, FormatMP3},
+		{"riff without wave", []byte("RIFF\x24\x00\x00\x00AVI "), ""},
+		{"truncated ogg", []byte("OggS\x00"), ""},
+		{"raw pcm", []byte{0x01, 0x00, 0x02, 0x00}, ""},
+		{"empty", nil, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, Sniff(tc.head))
+		})
+	}
+}
+
+// flacFixture encodes interleaved integer samples as a FLAC file of verbatim subframes
+func flacFixture(t *testing.T, bitDepth, channels, rate int, samples []int32) string {
+	t.Helper()
+	var (
+		frames = len(samples) / channels
+		buf    bytes.Buffer
+	)
+	enc, err := flac.NewEncoder(&buf, &meta.StreamInfo{
+		BlockSizeMin:  16,
+		BlockSizeMax:  uint16(frames),
+		SampleRate:    uint32(rate),
+		NChannels:     uint8(channels),
+		BitsPerSample: uint8(bitDepth),
+		NSamples:      uint64(frames),
+	})
+	require.NoError(t, err)
+	var subframes = make([]*frame.Subframe, channels)
+	for c := range subframes {
+		var channel = make([]int32, frames)
+		for i := range channel {
+			channel[i] = samples[i*channels+c]
+		}
+		subframes[c] = &frame.Subframe{
+			SubHeader: frame.SubHeader{Pred: frame.PredVerbatim},
+			Samples:   channel,
+			NSamples:  frames,
+		}
+	}
+	var layout = frame.ChannelsMono
+	if channels == 2 {
+		layout = frame.ChannelsLR
+	}
+	require.NoError(t, enc.WriteFrame(&frame.Frame{
+		Header: frame.Header{
+			HasFixedBlockSize: true,
+			BlockSize:         uint16(frames),
+			SampleRate:        uint32(rate),
+			Channels:          layout,
+			BitsPerSample:     uint8(bitDepth),
+		},
+		Subframes: subframes,
+	}))
+	require.NoError(t, enc.Close())
+
+	path := filepath.Join(t.TempDir(), "fixture.flac")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+	return path
+}
+
+func TestDecodeFLAC(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		bitDepth int
+		channels int
+		rate     int
+	}{
+		{"16-bit mono", 16, 1, 16000},
+		{"16-bit stereo", 16, 2, 44100},
+		{"24-bit stereo", 24, 2, 48000},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				scale   = float64(int64(1) << (tc.bitDepth - 1))
+				samples = make([]int32, 32*tc.channels)
+			)
+			for i := range samples {
+				samples[i] = int32(math.Sin(float64(i)/5) * (scale - 1))
+			}
+			pcm, err := Decode(flacFixture(t, tc.bitDepth, tc.channels, tc.rate, samples))
+			require.NoError(t, err)
+			require.Equal(t, tc.rate, pcm.SampleRate)
+			require.Equal(t, tc.channels, pcm.Channels)
+			require.Len(t, pcm.Samples, len(samples))
+			for i, s := range samples {
+				require.InDelta(t, float64(s)/scale, pcm.Samples[i], 1e-6, "sample %d", i)
+			}
+		})
+	}
+}
+
+func TestDecodeFLACSampleCount(t *testing.T) {
+	var samples = make([]int32, 32)
+	for i := range samples {
+		samples[i] = int32(i)
+	}
+	b, err := os.ReadFile(flacFixture(t, 16, 2, 16000, samples))
+	require.NoError(t, err)
+	// the 36-bit sample count ends the STREAMINFO fields after "fLaC", the block header
+	// and 10 bytes of block and frame sizes, claim its maximum
+	b[21] |= 0x0F
+	copy(b[22:26], []byte{0xFF, 0xFF, 0xFF, 0xFF})
+	pcm, err := DecodeReader(bytes.NewReader(b))
+	require.NoError(t, err)
+	require.Len(t, pcm.Samples, len(samples))
+}
+
+func TestDecodeVorbis(t *testing.T) {
+	// testdata/vorbis.ogg is the one second test file of github.com/jfreymuth/oggvorbis
+	pcm, err := Decode("testdata/vorbis.ogg")
+	require.NoError(t, err)
+	require.Equal(t, 44100, pcm.SampleRate)
+	require.Equal(t, 1, pcm.Channels)
+	require.Equal(t, 44100, pcm.Frames())
+}
+
+func TestDecodeOpus(t *testing.T) {
+	// builds without the opus tag reject the stream, with it the lone header page fails to open
+	path := filepath.Join(t.TempDir(), "clip.opus")
+	require.NoError(t, os.WriteFile(path, oggPage("OpusHead\x01\x01"), 0o644))
+	_, err := Decode(path)
+	require.ErrorContains(t, err, "opus")
+}
+
+func TestDecodeSniffsFormat(t *testing.T) {
+	// a WAV named like an MP3 and one without an extension both load
+	wav, err := os.ReadFile(wavFixture(t, wavFormatPCM, 16, 1, 16000, []float64{0, 0.5, -0.5}))
+	require.NoError(t, err)
+	for _, name := range []string{"clip.mp3", "clip"} {
+		path := filepath.Join(t.TempDir(), name)
+		require.NoError(t, os.WriteFile(path, wav, 0o644))
+		pcm, err := Decode(path)
+		require.NoError(t, err, name)
+		require.Equal(t, []float32{0, 0.5, -0.5}, pcm.Samples, name)
+	}
+	pcm, err := DecodeReader(bytes.NewReader(wav))
+	require.NoError(t, err)
+	require.Equal(t, []float32{0, 0.5, -0.5}, pcm.Samples)
+}
+
+func TestDecodeRaw(t *testing.T) {
+	var samples = []float32{0, 0.5, -0.5, -1, 0.25, -0.25}
+	for _, tc := range []struct {
+		format RawFormat
+		encode func([]byte, float32) []byte
+	}{
+		{RawFormat{S16LE, 8000, 1}, func(b []byte, s float32) []byte {
+			return binary.LittleEndian.AppendUint16(b, uint16(int16(s*(1<<15))))
+		}},
+		{RawFormat{S16LE, 16000, 2}, func(b []byte, s float32) []byte {
+			return binary.LittleEndian.AppendUint16(b, uint16(int16(s*(1<<15))))
+		}},
+		{RawFormat{F32LE, 48000, 3}, func(b []byte, s float32) []byte {
+			return binary.LittleEndian.AppendUint32(b, math.Float32bits(s))
+		}},
+	} {
+		t.Run(tc.format.String(), func(t *testing.T) {
+			var b []byte
+			for _, s := range samples {
+				b = tc.encode(b, s)
+			}
+			// a trailing partial frame is dropped
+			pcm, err := DecodeRaw(bytes.NewReader(append(b, 0)), tc.format)
+			require.NoError(t, err)
+			require.Equal(t, tc.format.SampleRate, pcm.SampleRate)
+			require.Equal(t, tc.format.Channels, pcm.Channels)
+			require.Equal(t, samples, pcm.Samples)
+
+			format, err := ParseRawFormat(tc.format.String())
+			require.NoError(t, err)
+			require.Equal(t, tc.format, format)
+		})
+	}
+	for _, s := range []string{"s16le:16000", "u8:16000:1", "s16le:0:1", "f32le:16000:x"} {
+		_, err := ParseRawFormat(s)
+		require.Error(t, err, s)
+	}
+}
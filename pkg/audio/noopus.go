@@ -0,0 +1,14 @@
+//go:build !opus
+
+package audio
+
+import (
+	"errors"
+	"io"
+)
+
+var errNoOpus = errors.New("built without libopusfile, build with -tags opus to decode opus or transcode to FLAC, Vorbis or WAV first")
+
+func decodeOpus(r io.Reader) (*PCM, error) {
+	return nil, errNoOpus
+}
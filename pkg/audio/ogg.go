@@ -0,0 +1,41 @@
+package audio
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/jfreymuth/oggvorbis"
+)
+
+// oggCodec returns the codec of an Ogg stream from the first packet of its first page
+func oggCodec(head []byte) Format {
+	// the segment table follows the 27 byte page header
+	if len(head) < 27 {
+		return ""
+	}
+	var start = 27 + int(head[26])
+	if len(head) < start {
+		return ""
+	}
+	switch packet := head[start:]; {
+	case bytes.HasPrefix(packet, []byte("\x01vorbis")):
+		return FormatVorbis
+	case bytes.HasPrefix(packet, []byte("OpusHead")):
+		return FormatOpus
+	default:
+		return ""
+	}
+}
+
+func decodeVorbis(r io.Reader) (*PCM, error) {
+	samples, format, err := oggvorbis.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading Ogg Vorbis data: %w", err)
+	}
+	return &PCM{
+		Samples:    samples,
+		SampleRate: format.SampleRate,
+		Channels:   format.Channels,
+	}, nil
+}
@@ -0,0 +1,67 @@
+//go:build opus
+
+package audio
+
+/*
+#cgo pkg-config: opusfile
+#include <stdlib.h>
+#include <opusfile.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+const (
+	// opusRate is the rate libopusfile always decodes at
+	opusRate = 48000
+	// opusMaxFrame is the longest Opus packet, 120ms at opusRate
+	opusMaxFrame = 5760
+)
+
+// decodeOpus reads an Ogg Opus stream with libopusfile, which applies the pre-skip
+// and output gain and follows chained streams
+func decodeOpus(r io.Reader) (*PCM, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading Ogg Opus data: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, errors.New("error opening Ogg Opus stream: no data")
+	}
+	// libopusfile reads from the buffer until it is freed, so it must not live in Go memory
+	var buf = C.CBytes(data)
+	defer C.free(buf)
+	var code C.int
+	file := C.op_open_memory((*C.uchar)(buf), C.size_t(len(data)), &code)
+	if file == nil {
+		return nil, fmt.Errorf("error opening Ogg Opus stream: libopusfile error %d", int(code))
+	}
+	defer C.op_free(file)
+	var (
+		channels = int(C.op_channel_count(file, -1))
+		pcm      = &PCM{SampleRate: opusRate, Channels: channels}
+		frame    = make([]float32, opusMaxFrame*channels)
+	)
+	for {
+		var link C.int
+		n := C.op_read_float(file, (*C.float)(unsafe.Pointer(&frame[0])), C.int(len(frame)), &link)
+		switch {
+		case n == 0:
+			return pcm, nil
+		case n == C.OP_HOLE:
+			// pages were lost, decoding continues after the gap
+			continue
+		case n < 0:
+			return nil, fmt.Errorf("error decoding Ogg Opus stream: libopusfile error %d", int(n))
+		}
+		if c := int(C.op_channel_count(file, link)); c != channels {
+			return nil, fmt.Errorf("Ogg Opus link has %d channels, stream has %d", c, channels)
+		}
+		pcm.Samples = append(pcm.Samples, frame[:int(n)*channels]...)
+	}
+}
@@ -0,0 +1,82 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Encoding is the sample layout of headerless pcm
+type Encoding string
+
+const (
+	S16LE Encoding = "s16le"
+	F32LE Encoding = "f32le"
+)
+
+// RawFormat describes headerless interleaved pcm which cannot be sniffed
+type RawFormat struct {
+	Encoding   Encoding
+	SampleRate int
+	Channels   int
+}
+
+// ParseRawFormat reads a format written as encoding:rate:channels, e.g. s16le:16000:1
+func ParseRawFormat(s string) (RawFormat, error) {
+	var parts = strings.Split(s, ":")
+	if len(parts) != 3 {
+		return RawFormat{}, fmt.Errorf("invalid raw format %q, expected encoding:rate:channels", s)
+	}
+	rate, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return RawFormat{}, fmt.Errorf("invalid raw sample rate %q: %w", parts[1], err)
+	}
+	channels, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return RawFormat{}, fmt.Errorf("invalid raw channel count %q: %w", parts[2], err)
+	}
+	var format = RawFormat{Encoding: Encoding(parts[0]), SampleRate: rate, Channels: channels}
+	return format, format.Validate()
+}
+
+// Validate checks the encoding is supported and the rate and channels are set
+func (f RawFormat) Validate() error {
+	if f.Encoding != S16LE && f.Encoding != F32LE {
+		return fmt.Errorf("unsupported raw encoding %q, expected %s or %s", f.Encoding, S16LE, F32LE)
+	}
+	if f.SampleRate <= 0 {
+		return fmt.Errorf("raw sample rate must be positive, got %d", f.SampleRate)
+	}
+	if f.Channels <= 0 {
+		return fmt.Errorf("raw channel count must be positive, got %d", f.Channels)
+	}
+	return nil
+}
+
+func (f RawFormat) String() string {
+	return fmt.Sprintf("%s:%d:%d", f.Encoding, f.SampleRate, f.Channels)
+}
+
+// wav describes the samples as the equivalent WAV format
+func (f RawFormat) wav() *wavFormat {
+	var format = &wavFormat{AudioFormat: wavFormatPCM, BitDepth: 16}
+	if f.Encoding == F32LE {
+		format = &wavFormat{AudioFormat: wavFormatFloat, BitDepth: 32}
+	}
+	format.NumChans = uint16(f.Channels)
+	format.SampleRate = uint32(f.SampleRate)
+	return format
+}
+
+// DecodeRaw reads headerless interleaved pcm until EOF
+func DecodeRaw(r io.Reader, format RawFormat) (*PCM, error) {
+	if err := format.Validate(); err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading raw pcm: %w", err)
+	}
+	return format.wav().decode(b)
+}
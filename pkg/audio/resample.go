@@ -0,0 +1,204 @@
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	// resampleAttenuation is the stopband attenuation of the anti-aliasing filter in dB
+	resampleAttenuation = 80
+	// resamplePassband is the fraction of the lower nyquist frequency kept intact,
+	// the transition band ends at the lower nyquist frequency so nothing aliases
+	resamplePassband = 0.8
+)
+
+// Resampler converts a mono stream between sample rates with a Kaiser windowed sinc
+// filter. The filter is split into one phase per fractional output position, so each
+// output sample costs one short dot product. It keeps the input history between calls,
+// consecutive chunks therefore join seamlessly and output is centered on the input
+// without group delay, at the cost of half the filter length of latency.
+type Resampler struct {
+	up, down int
+	half     int         // filter taps on each side of the output position
+	phases   [][]float32 // filter taps per fractional output position
+	buf      []float32   // input history starting at absolute sample base
+	base     int64
+	received int64 // input samples received
+	next     int64 // next output sample
+}
+
+// NewResampler creates a resampler from one sample rate to another
+func NewResampler(from, to int) (*Resampler, error) {
+	if from <= 0 || to <= 0 {
+		return nil, fmt.Errorf("invalid resampling from %dHz to %dHz", from, to)
+	}
+	var (
+		g         = gcd(from, to)
+		up        = to / g
+		down      = from / g
+		nyquist   = float64(min(from, to)) / 2
+		cutoff    = (1 + resamplePassband) / 2 * nyquist
+		width     = (1 - resamplePassband) * nyquist // transition band in Hz
+		beta      = 0.1102 * (resampleAttenuation - 8.7)
+		taps      = (resampleAttenuation - 8) / (2.285 * 2 * math.Pi * width / float64(from))
+		half      = max(2, int(math.Ceil(taps/2)))
+		scale     = 2 * cutoff / float64(from)
+		phases    = make([][]float32, up)
+		i0Beta    = bessel0(beta)
+		halfWidth = float64(half)
+	)
+	for p := range phases {
+		var (
+			frac   = float64(p) / float64(up)
+			coeffs = make([]float32, 2*half)
+		)
+		for j := range coeffs {
+			// distance in input samples between the output position and tap n0+j-half+1
+			x := frac - float64(j-half+1)
+			if math.Abs(x) >= halfWidth {
+				continue
+			}
+			window := bessel0(beta*math.Sqrt(1-(x/halfWidth)*(x/halfWidth))) / i0Beta
+			coeffs[j] = float32(scale * sinc(scale*x) * window)
+		}
+		phases[p] = coeffs
+	}
+	return &Resampler{
+		up:     up,
+		down:   down,
+		half:   half,
+		phases: phases,
+	}, nil
+}
+
+// Process resamples the next chunk of input and returns all output that no longer
+// depends on future input
+func (r *Resampler) Process(in []float32) []float32 {
+	r.buf = append(r.buf, in...)
+	r.received += int64(len(in))
+	return r.drain(r.received)
+}
+
+// Flush ends the stream and returns the remaining output assuming the input is followed by silence
+func (r *Resampler) Flush() []float32 {
+	var total = (r.received*int64(r.up) + int64(r.down) - 1) / int64(r.down)
+	var out []float32
+	for r.next < total {
+		r.buf = append(r.buf, make([]float32, r.half)...)
+		out = append(out, r.drain(r.base+int64(len(r.buf)))...)
+	}
+	return out[:len(out)-int(r.next-total)]
+}
+
+// Latency is the number of input samples held back to compute the next output
+func (r *Resampler) Latency() int {
+	return r.half
+}
+
+func (r *Resampler) drain(available int64) (out []float32) {
+	for {
+		var (
+			pos   = r.next * int64(r.down)
+			n0    = pos / int64(r.up)
+			phase = r.phases[pos%int64(r.up)]
+		)
+		if n0+int64(r.half) >= available {
+			break
+		}
+		var (
+			sum   float32
+			first = n0 - int64(r.half) + 1 - r.base
+		)
+		for j, c := range phase {
+			if idx := first + int64(j); idx >= 0 && idx < int64(len(r.buf)) {
+				sum += c * r.buf[idx]
+			}
+		}
+		out = append(out, sum)
+		r.next++
+	}
+	// drop the history no future output reaches back to
+	if keep := r.next*int64(r.down)/int64(r.up) - int64(r.half) + 1; keep > r.base {
+		var drop = min(keep-r.base, int64(len(r.buf)))
+		r.buf = append(r.buf[:0], r.buf[drop:]...)
+		r.base += drop
+	}
+	return out
+}
+
+// Resample converts a whole clip between sample rates
+func Resample(in []float32, from, to int) ([]float32, error) {
+	if from == to && from > 0 {
+		return in, nil
+	}
+	r, err := NewResampler(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return append(r.Process(in), r.Flush()...), nil
+}
+
+// resampledFrames re-chunks a source into frames of size samples, resampling them unless r is nil.
+// The last frame of a source ending in io.EOF holds the remaining samples
+func resampledFrames(next func() ([]float32, error), r *Resampler, size int) func() ([]float32, error) {
+	var (
+		pending []float32
+		done    bool
+	)
+	return func() ([]float32, error) {
+		for len(pending) < size && !done {
+			frame, err := next()
+			if errors.Is(err, io.EOF) {
+				done = true
+				if r != nil {
+					pending = append(pending, r.Flush()...)
+				}
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if r != nil {
+				frame = r.Process(frame)
+			}
+			pending = append(pending, frame...)
+		}
+		if len(pending) == 0 {
+			return nil, io.EOF
+		}
+		var n = min(size, len(pending))
+		var frame = append([]float32(nil), pending[:n]...)
+		pending = append(pending[:0], pending[n:]...)
+		return frame, nil
+	}
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// bessel0 is the zeroth order modified bessel function of the first kind
+func bessel0(x float64) float64 {
+	var sum, term = 1.0, 1.0
+	for k := 1; k < 50; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+		if term < sum*1e-12 {
+			break
+		}
+	}
+	return sum
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,144 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func sine(freq float64, rate, n int) []float32 {
+	var pcm = make([]float32, n)
+	for i := range pcm {
+		pcm[i] = float32(math.Sin(2 * math.Pi * freq * float64(i) / float64(rate)))
+	}
+	return pcm
+}
+
+// rmsDB returns the rms level in dB relative to a full scale sine
+func rmsDB(pcm []float32) float64 {
+	var sum float64
+	for _, s := range pcm {
+		sum += float64(s) * float64(s)
+	}
+	return 10 * math.Log10(2*sum/float64(len(pcm))+1e-20)
+}
+
+func TestResampleSineSweep(t *testing.T) {
+	for _, rates := range [][2]int{{48000, 16000}, {44100, 16000}, {22050, 16000}, {8000, 16000}} {
+		var from, to = rates[0], rates[1]
+		for freq := 250.0; freq < float64(from)/2; freq += 250 {
+			t.Run(fmt.Sprintf("%d_%d_%.0fHz", from, to, freq), func(t *testing.T) {
+				out, err := Resample(sine(freq, from, from), from, to)
+				require.NoError(t, err)
+				require.Len(t, out, to)
+				level := rmsDB(out[to/10 : to-to/10])
+				switch nyquist := float64(min(from, to)) / 2; {
+				case freq <= 0.8*nyquist:
+					require.InDelta(t, 0, level, 0.1, "passband tone must keep its level")
+				case freq >= nyquist:
+					require.Less(t, level, -70.0, "tone above the target nyquist must not alias")
+				}
+			})
+		}
+	}
+}
+
+func TestResampleChirpAliasing(t *testing.T) {
+	var (
+		from, to = 48000, 16000
+		seconds  = 4.0
+		n        = int(seconds * float64(from))
+		chirp    = make([]float32, n)
+		rate     = float64(from) / 2 / seconds // Hz per second up to the source nyquist
+	)
+	for i := range chirp {
+		ts := float64(i) / float64(from)
+		chirp[i] = float32(math.Sin(math.Pi * rate * ts * ts))
+	}
+	out, err := Resample(chirp, from, to)
+	require.NoError(t, err)
+	// every 100ms block where the sweep is above the target nyquist must be silent
+	var block = to / 10
+	for start := 0; start+block <= len(out); start += block {
+		freq := rate * float64(start+block/2) / float64(to)
+		level := rmsDB(out[start : start+block])
+		if freq > 8500 {
+			require.Less(t, level, -60.0, "aliasing at %.0fHz", freq)
+		} else if freq < 6000 && freq > 500 {
+			require.InDelta(t, 0, level, 0.5, "passband loss at %.0fHz", freq)
+		}
+	}
+}
+
+func TestResampleGroupDelay(t *testing.T) {
+	for _, rates := range [][2]int{{48000, 16000}, {44100, 16000}, {16000, 48000}} {
+		var from, to = rates[0], rates[1]
+		// an impulse must land on the same instant in the output
+		var impulse = make([]float32, from)
+		impulse[from/2] = 1
+		out, err := Resample(impulse, from, to)
+		require.NoError(t, err)
+		var peak int
+		for i := range out {
+			if math.Abs(float64(out[i])) > math.Abs(float64(out[peak])) {
+				peak = i
+			}
+		}
+		require.Equal(t, to/2, peak, "%d->%d impulse moved", from, to)
+		// a passband sine must match the ideal sine sampled at the new rate
+		var (
+			in    = sine(1000, from, from)
+			ideal = sine(1000, to, to)
+		)
+		out, err = Resample(in, from, to)
+		require.NoError(t, err)
+		for i := to / 10; i < to-to/10; i++ {
+			require.InDelta(t, ideal[i], out[i], 1e-3, "%d->%d phase error at %d", from, to, i)
+		}
+	}
+}
+
+func TestResamplerStreaming(t *testing.T) {
+	var in = sine(440, 44100, 44100)
+	whole, err := Resample(in, 44100, 16000)
+	require.NoError(t, err)
+	r, err := NewResampler(44100, 16000)
+	require.NoError(t, err)
+	var out []float32
+	for start := 0; start < len(in); start += 441 {
+		out = append(out, r.Process(in[start:min(start+441, len(in))])...)
+	}
+	out = append(out, r.Flush()...)
+	require.Equal(t, whole, out, "chunked resampling must match resampling the whole clip")
+}
+
+func TestResampleInvalidRate(t *testing.T) {
+	for _, rates := range [][2]int{{0, 16000}, {-44100, 16000}, {16000, 0}, {0, 0}} {
+		_, err := Resample(make([]float32, 160), rates[0], rates[1])
+		require.Error(t, err, "%d->%d", rates[0], rates[1])
+	}
+}
+
+func TestResampledFrames(t *testing.T) {
+	chunked, err := NewResampler(48000, 16000)
+	require.NoError(t, err)
+	r, err := NewResampler(48000, 16000)
+	require.NoError(t, err)
+	var (
+		in     = sine(440, 48000, 2*48000)
+		offset int
+		next   = resampledFrames(func() ([]float32, error) {
+			chunk := in[offset : offset+3600] // 75ms at 48kHz
+			offset += len(chunk)
+			return chunk, nil
+		}, chunked, 1200)
+		expected = r.Process(in)
+	)
+	for i := 0; i < 16000/1200; i++ {
+		frame, err := next()
+		require.NoError(t, err)
+		require.Equal(t, expected[i*1200:(i+1)*1200], frame)
+	}
+}
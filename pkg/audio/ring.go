@@ -0,0 +1,66 @@
+package audio
+
+// ringBuffer keeps the most recent samples written to it, addressed by their
+// absolute position in the stream
+type ringBuffer struct {
+	buf     []float32
+	written int64
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{buf: make([]float32, size)}
+}
+
+// Write appends samples, overwriting the oldest ones once full
+func (r *ringBuffer) Write(samples []float32) {
+	var size = int64(len(r.buf))
+	// only the last len(buf) samples survive
+	if len(samples) > len(r.buf) {
+		r.written += int64(len(samples) - len(r.buf))
+		samples = samples[len(samples)-len(r.buf):]
+	}
+	for len(samples) > 0 {
+		n := copy(r.buf[r.written%size:], samples)
+		samples = samples[n:]
+		r.written += int64(n)
+	}
+}
+
+// Read copies the samples at positions [end-len(dst), end) into dst, positions
+// not written yet or already overwritten are silence
+func (r *ringBuffer) Read(dst []float32, end int64) {
+	var (
+		size  = int64(len(r.buf))
+		start = end - int64(len(dst))
+		from  = max(start, r.written-size, 0)
+		to    = min(end, r.written)
+	)
+	clear(dst)
+	for p := from; p < to; {
+		// copy up to the end of the buffer then wrap around
+		n := copy(dst[p-start:to-start], r.buf[p%size:])
+		p += int64(n)
+	}
+}
+
+// Latest copies the most recent len(dst) samples into dst oldest first
+func (r *ringBuffer) Latest(dst []float32) {
+	r.Read(dst, r.written)
+}
+
+// Written returns the number of samples written since creation
+func (r *ringBuffer) Written() int64 {
+	return r.written
+}
+
+// Grow raises the capacity to size keeping the samples held
+func (r *ringBuffer) Grow(size int) {
+	if size <= len(r.buf) {
+		return
+	}
+	var held = make([]float32, min(r.written, int64(len(r.buf))))
+	r.Read(held, r.written)
+	var grown = &ringBuffer{buf: make([]float32, size), written: r.written - int64(len(held))}
+	grown.Write(held)
+	*r = *grown
+}
@@ -0,0 +1,71 @@
+package audio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// ramp returns the samples from, from+1, ... to-1
+func ramp(from, to int) []float32 {
+	var samples = make([]float32, 0, max(0, to-from))
+	for i := from; i < to; i++ {
+		samples = append(samples, float32(i))
+	}
+	return samples
+}
+
+func TestRingBuffer(t *testing.T) {
+	var r = newRingBuffer(5)
+	var window = make([]float32, 5)
+	r.Latest(window)
+	require.Equal(t, []float32{0, 0, 0, 0, 0}, window, "expected silence before the first write")
+
+	r.Write(ramp(1, 4))
+	r.Latest(window)
+	require.Equal(t, []float32{0, 0, 1, 2, 3}, window)
+
+	// wraps around the end of the buffer
+	r.Write(ramp(4, 8))
+	r.Latest(window)
+	require.Equal(t, []float32{3, 4, 5, 6, 7}, window)
+
+	// writes longer than the capacity keep their tail
+	r.Write(ramp(8, 20))
+	r.Latest(window)
+	require.Equal(t, []float32{15, 16, 17, 18, 19}, window)
+	require.EqualValues(t, 19, r.Written())
+
+	// shorter and longer destinations
+	var short = make([]float32, 2)
+	r.Latest(short)
+	require.Equal(t, []float32{18, 19}, short)
+	var long = make([]float32, 7)
+	r.Latest(long)
+	require.Equal(t, []float32{0, 0, 15, 16, 17, 18, 19}, long)
+}
+
+func TestRingBufferRead(t *testing.T) {
+	var r = newRingBuffer(4)
+	r.Write(ramp(0, 6))
+	var window = make([]float32, 3)
+	r.Read(window, 5)
+	require.Equal(t, []float32{2, 3, 4}, window)
+	// overwritten and future positions are silence
+	r.Read(window, 4)
+	require.Equal(t, []float32{0, 2, 3}, window)
+	r.Read(window, 8)
+	require.Equal(t, []float32{5, 0, 0}, window)
+
+	r.Grow(6)
+	r.Write(ramp(6, 8))
+	var all = make([]float32, 6)
+	r.Latest(all)
+	require.Equal(t, []float32{2, 3, 4, 5, 6, 7}, all, "expected growing to keep the held samples")
+
+	var partial = newRingBuffer(4)
+	partial.Write(ramp(1, 3))
+	partial.Grow(8)
+	partial.Latest(all)
+	require.Equal(t, []float32{0, 0, 0, 0, 1, 2}, all)
+}
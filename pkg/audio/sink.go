@@ -0,0 +1,257 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/algo-boyz/snowgirl/pkg/state"
+	"go.uber.org/multierr"
+)
+
+// Sink consumes mono frames at the model rate
+type Sink interface {
+	Write(frame Frame) error
+	Close() error
+}
+
+// errorReporter is implemented by sinks that fail outside of Write and Close, e.g. when
+// they finalise their files on shutdown
+type errorReporter interface {
+	OnError(fn func(error))
+}
+
+// sinkErrors holds the handlers of a sink's errorReporter
+type sinkErrors struct {
+	mu       sync.Mutex
+	handlers []func(error)
+}
+
+// OnError registers a handler for errors finalising the sink when its context exits
+func (e *sinkErrors) OnError(fn func(error)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.handlers = append(e.handlers, fn)
+}
+
+func (e *sinkErrors) report(err error) {
+	e.mu.Lock()
+	var handlers = append([]func(error){}, e.handlers...)
+	e.mu.Unlock()
+	for _, fn := range handlers {
+		fn(err)
+	}
+}
+
+// Attach subscribes the sink to consecutive frames of opts.HopSecs, the window is set to the hop
+// so no sample is written twice. The sink is closed when the stream ends or it fails to write,
+// errors, including those finalising the sink on shutdown, are reported to OnError handlers.
+// The returned channel can be passed to Stats and Unsubscribe
+func (s *AudioStream) Attach(sink Sink, opts SubscribeOptions) <-chan Frame {
+	if reporter, ok := sink.(errorReporter); ok {
+		reporter.OnError(s.report)
+	}
+	s.mu.Lock()
+	if opts.HopSecs == 0 {
+		opts.HopSecs = float32(s.cursor.hop) / SampleRate
+	}
+	s.mu.Unlock()
+	opts.WindowSecs = opts.HopSecs
+	var ch = s.Subscribe(opts)
+	go func() {
+		var failed bool
+		for frame := range ch {
+			if failed {
+				continue
+			}
+			if err := sink.Write(frame); err != nil {
+				s.report(fmt.Errorf("sink write: %w", err))
+				failed = true
+				// drained until the subscription is closed
+				go s.Unsubscribe(ch)
+			}
+		}
+		if err := sink.Close(); err != nil {
+			s.report(fmt.Errorf("sink close: %w", err))
+		}
+	}()
+	return ch
+}
+
+// WAVSink writes 16-bit PCM to a WAV file as it arrives, the header is finalised on Close
+type WAVSink struct {
+	sinkErrors
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	closed bool
+}
+
+// NewWAVSink creates the file and closes it when the context exits, so a recording
+// interrupted by shutdown still has a valid header. Failures to do so go to OnError handlers
+func NewWAVSink(ctx state.Context, path string) (*WAVSink, error) {
+	w, err := newWAVSink(path)
+	if err != nil {
+		return nil, err
+	}
+	go ctx.Defer(func() {
+		if err := w.Close(); err != nil {
+			w.report(fmt.Errorf("failed to finalise %s: %w", path, err))
+		}
+	})
+	return w, nil
+}
+
+// newWAVSink writes the header of a stream of unknown length, which readers accept until it is finalised
+func newWAVSink(path string) (*WAVSink, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = file.Write(pcm16Format(SampleRate, 1).header(0)); err != nil {
+		return nil, multierr.Combine(fmt.Errorf("error writing WAV header: %w", err), file.Close())
+	}
+	return &WAVSink{file: file}, nil
+}
+
+func (w *WAVSink) Write(frame Frame) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return fmt.Errorf("%s is closed", w.file.Name())
+	}
+	n, err := w.file.Write(encodePCM16(frame.Samples))
+	w.size += int64(n)
+	return err
+}
+
+// Close writes the RIFF and data sizes and closes the file, it may be called more than once.
+// Files past 4GiB keep the sizes of a stream
+func (w *WAVSink) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.size > math.MaxUint32-36 {
+		return w.file.Close()
+	}
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(36+w.size))
+	_, err := w.file.WriteAt(size[:], 4)
+	binary.LittleEndian.PutUint32(size[:], uint32(w.size))
+	_, errData := w.file.WriteAt(size[:], 40)
+	return multierr.Combine(err, errData, w.file.Close())
+}
+
+// RawSink writes headerless mono pcm at the model rate, e.g. to stdout for piping into other tools
+type RawSink struct {
+	w        io.Writer
+	encoding Encoding
+}
+
+// NewRawSink encodes frames as S16LE or F32LE, the writer is not closed by the sink
+func NewRawSink(w io.Writer, encoding Encoding) (*RawSink, error) {
+	if encoding != S16LE && encoding != F32LE {
+		return nil, fmt.Errorf("unsupported raw encoding %q, expected %s or %s", encoding, S16LE, F32LE)
+	}
+	return &RawSink{w: w, encoding: encoding}, nil
+}
+
+func (r *RawSink) Write(frame Frame) error {
+	var b = encodePCM16(frame.Samples)
+	if r.encoding == F32LE {
+		b = encodeFloat32(frame.Samples)
+	}
+	_, err := r.w.Write(b)
+	return err
+}
+
+func (r *RawSink) Close() error {
+	return nil
+}
+
+// RotatingSink writes WAV files of a fixed length to a directory, named after the
+// capture time of their first sample
+type RotatingSink struct {
+	sinkErrors
+	mu      sync.Mutex
+	dir     string
+	prefix  string
+	length  time.Duration
+	current *WAVSink
+	until   time.Time
+	closed  bool
+}
+
+// NewRotatingSink starts a new file in dir every length of audio and finalises the
+// last one when the context exits, failures to do so go to OnError handlers
+func NewRotatingSink(ctx state.Context, dir, prefix string, length time.Duration) (*RotatingSink, error) {
+	if length <= 0 {
+		return nil, fmt.Errorf("rotation length must be positive, got %s", length)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	var r = &RotatingSink{dir: dir, prefix: prefix, length: length}
+	go ctx.Defer(func() {
+		if err := r.Close(); err != nil {
+			r.report(fmt.Errorf("failed to finalise recording in %s: %w", dir, err))
+		}
+	})
+	return r, nil
+}
+
+// Write starts a new file once the frame begins past the current one's length,
+// frames are never split so files may run over by less than a frame
+func (r *RotatingSink) Write(frame Frame) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return fmt.Errorf("recording in %s is closed", r.dir)
+	}
+	var start = frame.Start()
+	if r.current == nil || !start.Before(r.until) {
+		if err := r.rotate(start); err != nil {
+			return err
+		}
+	}
+	return r.current.Write(frame)
+}
+
+func (r *RotatingSink) rotate(start time.Time) error {
+	if r.current != nil {
+		var err = r.current.Close()
+		r.current = nil
+		if err != nil {
+			return err
+		}
+	}
+	var path = filepath.Join(r.dir, fmt.Sprintf("%s_%s.wav", r.prefix, start.Format("20060102T150405.000")))
+	current, err := newWAVSink(path)
+	if err != nil {
+		return err
+	}
+	r.current, r.until = current, start.Add(r.length)
+	return nil
+}
+
+// Close finalises the current file
+func (r *RotatingSink) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if r.current == nil {
+		return nil
+	}
+	return r.current.Close()
+}
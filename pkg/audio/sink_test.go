@@ -0,0 +1,150 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/algo-boyz/snowgirl/pkg/state"
+	"github.com/stretchr/testify/require"
+)
+
+// closedSink signals when the stream closed the sink it wraps
+type closedSink struct {
+	Sink
+	closed chan struct{}
+}
+
+func (c *closedSink) Close() error {
+	defer close(c.closed)
+	return c.Sink.Close()
+}
+
+func watchClose(sink Sink) *closedSink {
+	return &closedSink{Sink: sink, closed: make(chan struct{})}
+}
+
+func TestWAVSink(t *testing.T) {
+	var (
+		ctx  = state.NewContext()
+		path = filepath.Join(t.TempDir(), "session.wav")
+	)
+	sink, err := NewWAVSink(ctx, path)
+	require.NoError(t, err)
+	require.NoError(t, sink.Write(Frame{Samples: []float32{0, 0.5}}))
+	require.NoError(t, sink.Write(Frame{Samples: []float32{-0.5, -1}}))
+
+	// an unfinalised recording reads as a stream
+	pcm, err := Decode(path)
+	require.NoError(t, err)
+	require.Equal(t, 4, pcm.Frames())
+
+	// the context finalises the header on exit
+	go ctx.Exit()
+	require.Eventually(t, func() bool {
+		b, err := os.ReadFile(path)
+		return err == nil && binary.LittleEndian.Uint32(b[40:44]) == 8 && binary.LittleEndian.Uint32(b[4:8]) == 44
+	}, time.Second, time.Millisecond)
+	require.NoError(t, sink.Close(), "closing twice is a no-op")
+	require.Error(t, sink.Write(Frame{Samples: []float32{0}}))
+
+	pcm, err = Decode(path)
+	require.NoError(t, err)
+	require.Equal(t, SampleRate, pcm.SampleRate)
+	for i, want := range []float32{0, 0.5, -0.5, -1} {
+		require.InDelta(t, want, pcm.Samples[i], 1.0/(1<<15), "sample %d", i)
+	}
+}
+
+func TestAttachSinks(t *testing.T) {
+	var (
+		ctx     = state.NewContext()
+		dir     = t.TempDir()
+		samples = ramp(0, 16000)
+		raw     bytes.Buffer
+	)
+	for i := range samples {
+		samples[i] /= 16000
+	}
+	rawSink, err := NewRawSink(&raw, F32LE)
+	require.NoError(t, err)
+	rotating, err := NewRotatingSink(ctx, dir, "session", 250*time.Millisecond)
+	require.NoError(t, err)
+
+	var (
+		stream = NewAudioStream(ctx, NewPCMSource(&PCM{Samples: samples, SampleRate: SampleRate, Channels: 1}, 20), 0.25, 0.125)
+		sinks  = []*closedSink{watchClose(rawSink), watchClose(rotating)}
+	)
+	for _, sink := range sinks {
+		stream.Attach(sink, SubscribeOptions{HopSecs: 0.1, Backpressure: Block})
+	}
+	require.NoError(t, stream.Start())
+	for _, sink := range sinks {
+		<-sink.closed
+	}
+
+	// the raw sink holds every sample exactly once
+	var decoded = make([]float32, raw.Len()/4)
+	for i := range decoded {
+		decoded[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw.Bytes()[i*4:]))
+	}
+	require.Equal(t, samples, decoded)
+
+	// frames of 100ms rotate to a new file once they start 250ms past the file's first
+	files, err := filepath.Glob(filepath.Join(dir, "session_*.wav"))
+	require.NoError(t, err)
+	require.Len(t, files, 4)
+	var joined []float32
+	for i, file := range files {
+		pcm, err := Decode(file)
+		require.NoError(t, err)
+		require.Equal(t, []int{4800, 4800, 4800, 1600}[i], pcm.Frames(), file)
+		joined = append(joined, pcm.Samples...)
+	}
+	require.InDeltaSlice(t, samples, joined, 1.0/(1<<15))
+}
+
+// failingSink fails every write
+type failingSink struct{}
+
+func (failingSink) Write(Frame) error { return errors.New("disk full") }
+func (failingSink) Close() error      { return nil }
+
+func TestAttachFailingSink(t *testing.T) {
+	var (
+		stream = NewAudioStream(state.NewContext(), NewPCMSource(&PCM{Samples: make([]float32, 16000), SampleRate: SampleRate, Channels: 1}, 10), 0.25, 0.125)
+		sink   = watchClose(failingSink{})
+		errs   = make(chan error, 10)
+	)
+	stream.OnError(func(err error) { errs <- err })
+	var ch = stream.Attach(sink, SubscribeOptions{HopSecs: 0.1})
+	require.NoError(t, stream.Start())
+	require.ErrorContains(t, <-errs, "disk full")
+	<-sink.closed
+	// the failed sink no longer receives frames
+	require.Eventually(t, func() bool {
+		_, ok := stream.Stats(ch)
+		return !ok
+	}, time.Second, time.Millisecond)
+}
+
+func TestAttachReportsFinalise(t *testing.T) {
+	var (
+		ctx    = state.NewContext()
+		stream = NewAudioStream(ctx, NewPCMSource(&PCM{Samples: make([]float32, 16000), SampleRate: SampleRate, Channels: 1}, 10), 0.25, 0.125)
+		errs   = make(chan error, 10)
+	)
+	sink, err := NewWAVSink(ctx, filepath.Join(t.TempDir(), "session.wav"))
+	require.NoError(t, err)
+	stream.OnError(func(err error) { errs <- err })
+	stream.Attach(sink, SubscribeOptions{HopSecs: 0.1})
+	// the header can no longer be written once the file is gone
+	require.NoError(t, sink.file.Close())
+	go ctx.Exit()
+	require.ErrorContains(t, <-errs, "failed to finalise")
+}
@@ -0,0 +1,203 @@
+package audio
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+// AudioSource produces mono pcm in chunks of any size at its own sample rate,
+// sources implementing ChannelSource produce interleaved channels
+type AudioSource interface {
+	// Start begins capture or playback
+	Start() error
+	// Read blocks until the next chunk is available, io.EOF ends the stream
+	Read() ([]float32, error)
+	// SampleRate of the chunks returned by Read
+	SampleRate() int
+	Close() error
+}
+
+// readerChunkSecs is the duration of pcm a ReaderSource waits for per read
+const readerChunkSecs = 0.02
+
+// ReaderSource streams interleaved pcm from a reader, e.g. a pipe or socket, and downmixes it to mono
+type ReaderSource struct {
+	r          io.Reader
+	channels   int
+	rate       int
+	sample     func([]byte) float32
+	blockAlign int
+	buffer     []byte
+}
+
+// NewReaderSource reads headerless pcm of the given format
+func NewReaderSource(r io.Reader, format RawFormat) (*ReaderSource, error) {
+	if err := format.Validate(); err != nil {
+		return nil, err
+	}
+	return newReaderSource(r, format.wav())
+}
+
+func newReaderSource(r io.Reader, format *wavFormat) (*ReaderSource, error) {
+	sample, blockAlign, err := format.sampler()
+	if err != nil {
+		return nil, err
+	}
+	var frames = max(1, int(float64(format.SampleRate)*readerChunkSecs))
+	return &ReaderSource{
+		r:          r,
+		channels:   int(format.NumChans),
+		rate:       int(format.SampleRate),
+		sample:     sample,
+		blockAlign: blockAlign,
+		buffer:     make([]byte, frames*blockAlign),
+	}, nil
+}
+
+func (s *ReaderSource) Start() error {
+	return nil
+}
+
+func (s *ReaderSource) Read() ([]float32, error) {
+	n, err := io.ReadFull(s.r, s.buffer)
+	// a short read at the end of the stream still returns its whole frames, a partial frame is dropped
+	if errors.Is(err, io.ErrUnexpectedEOF) && n < s.blockAlign {
+		return nil, io.EOF
+	}
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	var (
+		bytesPerSample = s.blockAlign / s.channels
+		mono           = make([]float32, n/s.blockAlign)
+	)
+	for i := range mono {
+		var sum float32
+		for c := 0; c < s.channels; c++ {
+			sum += s.sample(s.buffer[i*s.blockAlign+c*bytesPerSample:])
+		}
+		mono[i] = sum / float32(s.channels)
+	}
+	return mono, nil
+}
+
+func (s *ReaderSource) SampleRate() int {
+	return s.rate
+}
+
+// Close closes the underlying reader when it is a closer
+func (s *ReaderSource) Close() error {
+	if closer, ok := s.r.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// pcmChunkSecs is the duration of audio a PCMSource returns per read
+const pcmChunkSecs = 0.1
+
+// PCMSource plays decoded audio paced to real time multiplied by its speed
+type PCMSource struct {
+	samples []float32
+	rate    int
+	speed   float64
+	chunk   int
+	pos     int
+	started time.Time
+}
+
+// NewPCMSource downmixes decoded audio, a speed of 1 plays it in real time and 2 twice as fast
+func NewPCMSource(pcm *PCM, speed float64) *PCMSource {
+	if speed <= 0 {
+		speed = 1
+	}
+	return &PCMSource{
+		samples: pcm.Mono(),
+		rate:    pcm.SampleRate,
+		speed:   speed,
+		chunk:   max(1, int(float64(pcm.SampleRate)*pcmChunkSecs)),
+	}
+}
+
+// NewFileSource decodes a whole audio file for playback, a nil raw format sniffs the file format
+func NewFileSource(filePath string, raw *RawFormat, speed float64) (_ *PCMSource, err error) {
+	if raw == nil {
+		pcm, err := Decode(filePath)
+		if err != nil {
+			return nil, err
+		}
+		return NewPCMSource(pcm, speed), nil
+	}
+	audioFile, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening raw pcm file: %v", err)
+	}
+	defer func() {
+		err = multierr.Combine(err, audioFile.Close())
+	}()
+	pcm, err := DecodeRaw(bufio.NewReader(audioFile), *raw)
+	if err != nil {
+		return nil, err
+	}
+	return NewPCMSource(pcm, speed), nil
+}
+
+func (s *PCMSource) Start() error {
+	s.started = time.Now()
+	return nil
+}
+
+// Read sleeps until the end of the next chunk is due
+func (s *PCMSource) Read() ([]float32, error) {
+	if s.pos >= len(s.samples) {
+		return nil, io.EOF
+	}
+	var end = min(s.pos+s.chunk, len(s.samples))
+	var due = s.started.Add(time.Duration(float64(end) / float64(s.rate) / s.speed * float64(time.Second)))
+	time.Sleep(time.Until(due))
+	var chunk = append([]float32(nil), s.samples[s.pos:end]...)
+	s.pos = end
+	return chunk, nil
+}
+
+func (s *PCMSource) SampleRate() int {
+	return s.rate
+}
+
+func (s *PCMSource) Close() error {
+	return nil
+}
+
+// NewStdinSource streams audio piped to stdin, see NewStreamSource
+func NewStdinSource(raw *RawFormat) (AudioSource, error) {
+	return NewStreamSource(os.Stdin, raw)
+}
+
+// NewStreamSource streams pcm from a reader. WAV streams such as the output of arecord are read
+// from their header, headerless pcm needs a raw format, and any other format is decoded whole
+// and played in real time
+func NewStreamSource(r io.Reader, raw *RawFormat) (AudioSource, error) {
+	if raw != nil {
+		return NewReaderSource(r, *raw)
+	}
+	var br = bufio.NewReader(r)
+	head, _ := br.Peek(sniffSize)
+	if Sniff(head) == FormatWAV {
+		format, data, err := readWAVHeader(br)
+		if err != nil {
+			return nil, err
+		}
+		return newReaderSource(data, format)
+	}
+	pcm, err := decode(br, "")
+	if err != nil {
+		return nil, err
+	}
+	return NewPCMSource(pcm, 1), nil
+}
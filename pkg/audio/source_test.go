@@ -0,0 +1,110 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/algo-boyz/snowgirl/pkg/state"
+	"github.com/stretchr/testify/require"
+)
+
+// readAll drains a source, returning its chunk sizes and samples
+func readAll(t *testing.T, source AudioSource) (sizes []int, samples []float32) {
+	t.Helper()
+	require.NoError(t, source.Start())
+	for {
+		chunk, err := source.Read()
+		if err == io.EOF {
+			return sizes, samples
+		}
+		require.NoError(t, err)
+		sizes = append(sizes, len(chunk))
+		samples = append(samples, chunk...)
+	}
+}
+
+func TestReaderSource(t *testing.T) {
+	// 45 stereo frames at 1kHz are two 20ms chunks and a short one
+	var (
+		b    []byte
+		want []float32
+	)
+	for i := 0; i < 45; i++ {
+		left, right := float32(i)/64, float32(i)/128
+		b = binary.LittleEndian.AppendUint16(b, uint16(int16(left*(1<<15))))
+		b = binary.LittleEndian.AppendUint16(b, uint16(int16(right*(1<<15))))
+		want = append(want, (left+right)/2)
+	}
+	source, err := NewReaderSource(bytes.NewReader(append(b, 0)), RawFormat{S16LE, 1000, 2})
+	require.NoError(t, err)
+	require.Equal(t, 1000, source.SampleRate())
+	sizes, samples := readAll(t, source)
+	require.Equal(t, []int{20, 20, 5}, sizes)
+	require.InDeltaSlice(t, want, samples, 1e-4)
+}
+
+func TestReaderSourcePartialFrame(t *testing.T) {
+	// a stream one byte short of its 21st stereo frame ends after the first chunk
+	source, err := NewReaderSource(bytes.NewReader(make([]byte, 21*4-1)), RawFormat{S16LE, 1000, 2})
+	require.NoError(t, err)
+	sizes, samples := readAll(t, source)
+	require.Equal(t, []int{20}, sizes)
+	require.Equal(t, make([]float32, 20), samples)
+}
+
+func TestPCMSource(t *testing.T) {
+	var pcm = &PCM{Samples: make([]float32, 1000), SampleRate: 1000, Channels: 1}
+	for i := range pcm.Samples {
+		pcm.Samples[i] = float32(i) / 1000
+	}
+	// one second played ten times faster than real time
+	var start = time.Now()
+	sizes, samples := readAll(t, NewPCMSource(pcm, 10))
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond, "expected playback to be paced")
+	require.Len(t, sizes, 10)
+	require.Equal(t, pcm.Samples, samples)
+}
+
+func TestStreamSourceWAV(t *testing.T) {
+	wav, err := os.ReadFile(wavFixture(t, wavFormatPCM, 16, 2, 16000, []float64{0.5, 0, -0.5, -0.25, 0.25, 0.25}))
+	require.NoError(t, err)
+	// streamed WAVs such as arecord's carry no data size
+	binary.LittleEndian.PutUint32(wav[len(wav)-12-4:], math.MaxUint32)
+	source, err := NewStreamSource(bytes.NewReader(wav), nil)
+	require.NoError(t, err)
+	require.IsType(t, &ReaderSource{}, source)
+	_, samples := readAll(t, source)
+	require.Equal(t, []float32{0.25, -0.375, 0.25}, samples)
+}
+
+func TestAudioStream(t *testing.T) {
+	// two seconds at 8kHz are resampled to three 0.75s hops, the last one padded
+	var pcm = &PCM{Samples: make([]float32, 16000), SampleRate: 8000, Channels: 1}
+	for i := range pcm.Samples {
+		pcm.Samples[i] = float32(math.Sin(float64(i) / 10))
+	}
+	var (
+		ctx    = state.NewContext()
+		stream = NewAudioStream(ctx, NewPCMSource(pcm, 100), 1.5, 0.75)
+		frames = stream.Subscribe(SubscribeOptions{})
+	)
+	require.NoError(t, stream.Start())
+	var received []Frame
+	for frame := range frames {
+		received = append(received, frame)
+	}
+	require.Len(t, received, 3, "expected the channel to close when the source ends")
+	for i, frame := range received {
+		require.Len(t, frame.Samples, 24000)
+		if i > 0 {
+			require.Equal(t, 750*time.Millisecond, frame.Time.Sub(received[i-1].Time), "expected frames spaced by the audio they hold")
+		}
+	}
+	// unsubscribing after the source ended is a no-op
+	stream.Unsubscribe(frames)
+}
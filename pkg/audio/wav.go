@@ -0,0 +1,251 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"go.uber.org/multierr"
+)
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xFFFE
+
+	// wavMaxFmtSize bounds the fmt chunk, the extensible format needs 40 bytes
+	wavMaxFmtSize = 64
+)
+
+// wavFormat is the fmt chunk of a WAV file, extensible files carry the
+// actual format in the first two bytes of their sub format guid
+type wavFormat struct {
+	AudioFormat   uint16
+	NumChans      uint16
+	SampleRate    uint32
+	ByteRate      uint32
+	BlockAlign    uint16
+	BitDepth      uint16
+	ExtensionSize uint16
+	ValidBits     uint16
+	ChannelMask   uint32
+	SubFormat     [16]byte
+}
+
+// decodeWAV reads integer PCM of 8, 16, 24 or 32 bits and IEEE float WAVs of 32 or 64 bits
+// with any number of channels
+func decodeWAV(r io.Reader) (*PCM, error) {
+	format, data, err := readWAVHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(data)
+	if err != nil {
+		return nil, fmt.Errorf("error reading WAV data: %w", err)
+	}
+	return format.decode(b)
+}
+
+// readWAVHeader reads up to the data chunk and returns a reader limited to it
+func readWAVHeader(r io.Reader) (*wavFormat, io.Reader, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return nil, nil, fmt.Errorf("invalid WAV file: %w", err)
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, nil, fmt.Errorf("invalid WAV file: missing RIFF/WAVE header")
+	}
+	var format *wavFormat
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, nil, fmt.Errorf("invalid WAV file: no data chunk: %w", err)
+		}
+		var (
+			id   = string(header[0:4])
+			size = binary.LittleEndian.Uint32(header[4:8])
+		)
+		switch id {
+		case "fmt ":
+			if size > wavMaxFmtSize {
+				return nil, nil, fmt.Errorf("invalid WAV fmt chunk size %d", size)
+			}
+			b := make([]byte, int64(size)+int64(size%2))
+			if _, err := io.ReadFull(r, b); err != nil {
+				return nil, nil, fmt.Errorf("invalid WAV fmt chunk: %w", err)
+			}
+			f, err := parseWAVFormat(b[:size])
+			if err != nil {
+				return nil, nil, err
+			}
+			format = f
+		case "data":
+			if format == nil {
+				return nil, nil, fmt.Errorf("invalid WAV file: data chunk before fmt chunk")
+			}
+			// streamed files, e.g. from arecord, leave the size at zero or near the maximum
+			if size == 0 || size >= math.MaxInt32 {
+				return format, r, nil
+			}
+			return format, io.LimitReader(r, int64(size)), nil
+		default:
+			if _, err := io.CopyN(io.Discard, r, int64(size)+int64(size%2)); err != nil {
+				return nil, nil, fmt.Errorf("invalid WAV %q chunk: %w", id, err)
+			}
+		}
+	}
+}
+
+func parseWAVFormat(b []byte) (*wavFormat, error) {
+	if len(b) < 16 {
+		return nil, fmt.Errorf("invalid WAV fmt chunk size %d", len(b))
+	}
+	var f = &wavFormat{
+		AudioFormat: binary.LittleEndian.Uint16(b[0:2]),
+		NumChans:    binary.LittleEndian.Uint16(b[2:4]),
+		SampleRate:  binary.LittleEndian.Uint32(b[4:8]),
+		ByteRate:    binary.LittleEndian.Uint32(b[8:12]),
+		BlockAlign:  binary.LittleEndian.Uint16(b[12:14]),
+		BitDepth:    binary.LittleEndian.Uint16(b[14:16]),
+	}
+	if f.AudioFormat == wavFormatExtensible {
+		if len(b) < 40 {
+			return nil, fmt.Errorf("invalid WAV extensible fmt chunk size %d", len(b))
+		}
+		f.ExtensionSize = binary.LittleEndian.Uint16(b[16:18])
+		f.ValidBits = binary.LittleEndian.Uint16(b[18:20])
+		f.ChannelMask = binary.LittleEndian.Uint32(b[20:24])
+		copy(f.SubFormat[:], b[24:40])
+		f.AudioFormat = binary.LittleEndian.Uint16(f.SubFormat[0:2])
+	}
+	if f.NumChans == 0 {
+		return nil, fmt.Errorf("invalid WAV file: no channels")
+	}
+	if f.SampleRate == 0 {
+		return nil, fmt.Errorf("invalid WAV file: zero sample rate")
+	}
+	return f, nil
+}
+
+// sampler returns the converter of a single little endian sample to float32 in [-1, 1)
+// and the size of one frame of all channels in bytes
+func (f *wavFormat) sampler() (sample func([]byte) float32, blockAlign int, err error) {
+	switch {
+	case f.AudioFormat == wavFormatPCM && f.BitDepth == 8:
+		// 8-bit samples are unsigned
+		sample = func(s []byte) float32 { return (float32(s[0]) - 128) / 128 }
+	case f.AudioFormat == wavFormatPCM && f.BitDepth == 16:
+		sample = func(s []byte) float32 { return float32(int16(binary.LittleEndian.Uint16(s))) / (1 << 15) }
+	case f.AudioFormat == wavFormatPCM && f.BitDepth == 24:
+		sample = func(s []byte) float32 {
+			return float32(int32(uint32(s[0])<<8|uint32(s[1])<<16|uint32(s[2])<<24)>>8) / (1 << 23)
+		}
+	case f.AudioFormat == wavFormatPCM && f.BitDepth == 32:
+		sample = func(s []byte) float32 { return float32(float64(int32(binary.LittleEndian.Uint32(s))) / (1 << 31)) }
+	case f.AudioFormat == wavFormatFloat && f.BitDepth == 32:
+		sample = func(s []byte) float32 { return math.Float32frombits(binary.LittleEndian.Uint32(s)) }
+	case f.AudioFormat == wavFormatFloat && f.BitDepth == 64:
+		sample = func(s []byte) float32 { return float32(math.Float64frombits(binary.LittleEndian.Uint64(s))) }
+	default:
+		return nil, 0, fmt.Errorf("unsupported WAV format %d with %d bits per sample", f.AudioFormat, f.BitDepth)
+	}
+	return sample, int(f.NumChans) * (int(f.BitDepth+7) / 8), nil
+}
+
+// decode converts interleaved little endian samples to float32 in [-1, 1)
+func (f *wavFormat) decode(b []byte) (*PCM, error) {
+	sample, blockAlign, err := f.sampler()
+	if err != nil {
+		return nil, err
+	}
+	var bytesPerSample = blockAlign / int(f.NumChans)
+	// Drop a trailing partial frame
+	b = b[:len(b)/blockAlign*blockAlign]
+	var pcm = &PCM{
+		Samples:    make([]float32, len(b)/bytesPerSample),
+		SampleRate: int(f.SampleRate),
+		Channels:   int(f.NumChans),
+	}
+	for i := range pcm.Samples {
+		pcm.Samples[i] = sample(b[i*bytesPerSample:])
+	}
+	return pcm, nil
+}
+
+// WriteWAV encodes the samples as 16-bit PCM
+func WriteWAV(w io.Writer, pcm *PCM) error {
+	var (
+		f    = pcm16Format(pcm.SampleRate, pcm.Channels)
+		data = encodePCM16(pcm.Samples)
+	)
+	if _, err := w.Write(f.header(uint32(len(data)))); err != nil {
+		return fmt.Errorf("error writing WAV header: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("error writing WAV data: %w", err)
+	}
+	return nil
+}
+
+// SaveWAV writes the samples to a 16-bit PCM WAV file
+func SaveWAV(path string, pcm *PCM) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = WriteWAV(f, pcm); err != nil {
+		return multierr.Combine(err, f.Close(), os.Remove(path))
+	}
+	return f.Close()
+}
+
+func pcm16Format(rate, channels int) *wavFormat {
+	return &wavFormat{
+		AudioFormat: wavFormatPCM,
+		NumChans:    uint16(channels),
+		SampleRate:  uint32(rate),
+		ByteRate:    uint32(rate * channels * 2),
+		BlockAlign:  uint16(channels * 2),
+		BitDepth:    16,
+	}
+}
+
+// header returns the RIFF header, fmt chunk and data chunk header for dataSize bytes of samples
+func (f *wavFormat) header(dataSize uint32) []byte {
+	var b = make([]byte, 44)
+	copy(b[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(b[4:8], 36+dataSize)
+	copy(b[8:16], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(b[16:20], 16)
+	binary.LittleEndian.PutUint16(b[20:22], f.AudioFormat)
+	binary.LittleEndian.PutUint16(b[22:24], f.NumChans)
+	binary.LittleEndian.PutUint32(b[24:28], f.SampleRate)
+	binary.LittleEndian.PutUint32(b[28:32], f.ByteRate)
+	binary.LittleEndian.PutUint16(b[32:34], f.BlockAlign)
+	binary.LittleEndian.PutUint16(b[34:36], f.BitDepth)
+	copy(b[36:40], "data")
+	binary.LittleEndian.PutUint32(b[40:44], dataSize)
+	return b
+}
+
+// encodePCM16 converts float32 samples to 16-bit little endian PCM, clipping them to [-1, 1]
+func encodePCM16(samples []float32) []byte {
+	var b = make([]byte, len(samples)*2)
+	for i, s := range samples {
+		var v = math.Round(float64(s) * (1 << 15))
+		v = math.Max(math.MinInt16, math.Min(math.MaxInt16, v))
+		binary.LittleEndian.PutUint16(b[i*2:], uint16(int16(v)))
+	}
+	return b
+}
+
+// encodeFloat32 converts samples to 32-bit little endian IEEE floats
+func encodeFloat32(samples []float32) []byte {
+	var b = make([]byte, len(samples)*4)
+	for i, s := range samples {
+		binary.LittleEndian.PutUint32(b[i*4:], math.Float32bits(s))
+	}
+	return b
+}
@@ -0,0 +1,34 @@
+package audio
+
+// SlidingWindows slides a window over the pcm with the same sizes as NewAudioStream
+// and calls fn with the sample offset of each window, the last window is zero padded
+func SlidingWindows(pcm []float32, windowLengthSecs, slidingWindowSecs float32, fn func(offset int, window []float32) error) error {
+	var (
+		windowSize        = int(windowLengthSecs * float32(SampleRate))
+		slidingWindowSize = int(max(1, slidingWindowSecs*float32(SampleRate)))
+	)
+	for offset := 0; ; offset += slidingWindowSize {
+		var window = pcm[min(offset, len(pcm)):min(offset+windowSize, len(pcm))]
+		if len(window) < windowSize {
+			var padded = make([]float32, windowSize)
+			copy(padded, window)
+			window = padded
+		}
+		if err := fn(offset, window); err != nil {
+			return err
+		}
+		if offset+windowSize >= len(pcm) {
+			return nil
+		}
+	}
+}
+
+// Seconds converts a number of samples to seconds at the pipeline sample rate
+func Seconds(samples int) float64 {
+	return float64(samples) / SampleRate
+}
+
+// Samples converts seconds to a number of samples at the pipeline sample rate
+func Samples(secs float64) int {
+	return int(secs * SampleRate)
+}
@@ -0,0 +1,34 @@
+package audio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlidingWindows(t *testing.T) {
+	var pcm = make([]float32, SampleRate*2)
+	for i := range pcm {
+		pcm[i] = float32(i)
+	}
+	var offsets []int
+	err := SlidingWindows(pcm, 1.5, 0.75, func(offset int, window []float32) error {
+		require.Len(t, window, 24000)
+		require.Equal(t, float32(offset), window[0])
+		offsets = append(offsets, offset)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 12000}, offsets)
+}
+
+func TestSlidingWindowsShortClip(t *testing.T) {
+	var calls int
+	err := SlidingWindows(make([]float32, 100), 1.5, 0.75, func(offset int, window []float32) error {
+		require.Len(t, window, 24000, "expected a zero padded window")
+		calls++
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, calls)
+}
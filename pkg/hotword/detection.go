@@ -0,0 +1,26 @@
+package hotword
+
+import "time"
+
+// Detection is emitted when a wakeword crosses its threshold
+type Detection struct {
+	Wakeword   string
+	Confidence float32
+	// Time is the capture time of the last sample in the window
+	Time time.Time
+	// Audio is the window that triggered the detection
+	Audio []float32
+	// Channel is the input channel that fired, -1 when the channels were averaged
+	Channel int
+	// Azimuth is the direction the wakeword came from in degrees counterclockwise from
+	// the x axis of the mic array, nil without an array
+	Azimuth *float64
+	// Clip is the path of the WAV recorded around the detection, empty when not recording
+	Clip string
+}
+
+// FrameScores holds the confidence of every wakeword for one audio window
+type FrameScores struct {
+	Time   time.Time
+	Scores []Score
+}
@@ -0,0 +1,111 @@
+package hotword
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Score is the confidence of a single wakeword for one audio window
+type Score struct {
+	Wakeword   string
+	Confidence float32
+	// Triggered is set when the confidence crossed the wakeword threshold
+	Triggered bool
+	// Detected is set when the detection policy confirmed the wakeword
+	Detected bool
+	// Channel is the input channel the confidence was scored on
+	Channel int
+}
+
+// Detector scores every loaded wakeword from a single inference pass
+type Detector struct {
+	model     *Model
+	policy    Policy
+	Wakewords []*Wakeword
+	states    []policyState
+	mu        sync.Mutex
+}
+
+// NewDetector shares one model between any number of wakewords, each confirmed by the policy
+func NewDetector(model *Model, policy Policy, wakewords ...*Wakeword) (*Detector, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	for _, w := range wakewords {
+		if model != nil && w.Reference != nil {
+			if err := model.Verify(w.Reference); err != nil {
+				return nil, err
+			}
+		}
+	}
+	var states = make([]policyState, len(wakewords))
+	for i := range states {
+		states[i] = newPolicyState(policy)
+	}
+	return &Detector{
+		model:     model,
+		policy:    policy,
+		Wakewords: wakewords,
+		states:    states,
+	}, nil
+}
+
+// Detect runs the model once on a vectorized audio window captured at the given time
+// and scores the result against every wakeword
+func (d *Detector) Detect(at time.Time, frame []float32) ([]Score, error) {
+	output, err := d.model.ProcessFrame(frame)
+	if err != nil {
+		return nil, fmt.Errorf("model.ProcessFrame: %w", err)
+	}
+	return d.Score(at, output), nil
+}
+
+// Score compares an inference output against every wakeword
+func (d *Detector) Score(at time.Time, output []float32) []Score {
+	return d.ScoreChannels(at, [][]float32{output})
+}
+
+// DetectChannels runs the model on the vectorized window of every channel and confirms
+// each wakeword on the channel it scored best on, so a word heard by several mics fires once
+func (d *Detector) DetectChannels(at time.Time, frames [][]float32) ([]Score, error) {
+	var outputs = make([][]float32, len(frames))
+	for c, frame := range frames {
+		output, err := d.model.ProcessFrame(frame)
+		if err != nil {
+			return nil, fmt.Errorf("model.ProcessFrame: %w", err)
+		}
+		outputs[c] = output
+	}
+	return d.ScoreChannels(at, outputs), nil
+}
+
+// ScoreChannels compares the inference output of every channel against every wakeword
+// and keeps the best channel of each
+func (d *Detector) ScoreChannels(at time.Time, outputs [][]float32) []Score {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var scores = make([]Score, len(d.Wakewords))
+	for i, w := range d.Wakewords {
+		scores[i] = Score{Wakeword: w.Name, Confidence: -1}
+		for c, output := range outputs {
+			if confidence := w.Score(output); confidence > scores[i].Confidence {
+				scores[i].Confidence, scores[i].Channel = confidence, c
+			}
+		}
+		scores[i].Triggered = scores[i].Confidence > w.Threshold
+		scores[i].Detected = d.states[i].confirm(d.policy, at, scores[i].Triggered)
+	}
+	return scores
+}
+
+// Reset forgets the recent windows and refractory periods of every wakeword,
+// e.g. after a pause or before scanning the next file on a restarted clock
+func (d *Detector) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range d.states {
+		d.states[i].reset()
+		d.states[i].lastFired = time.Time{}
+	}
+}
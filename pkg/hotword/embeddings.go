@@ -1,11 +1,24 @@
 package hotword
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+
+	"go.uber.org/multierr"
 )
 
+// ReferenceVersion is the current wakeword reference file format,
+// files without a version are EfficientWord-Net *_ref.json files
+const ReferenceVersion = 1
+
+// DefaultThreshold is used when neither the config nor the reference set a threshold
+const DefaultThreshold float32 = 0.9
+
 func OnnxModelPath() string {
 	return "model/hotword/resnet_qint8.onnx"
 }
@@ -14,18 +27,88 @@ func EmbeddingsPath() string {
 	return "model/hotword/computer_ref.json"
 }
 
-type embeddingsJSON struct {
-	Embeddings [][]float32 `json:"embeddings"`
+// Reference is a wakeword reference file with the metadata needed to verify
+// that its embeddings were produced by the loaded model
+type Reference struct {
+	Version  int    `json:"version,omitempty"`
+	Wakeword string `json:"wakeword,omitempty"`
+	// ModelType is set by EfficientWord-Net, e.g. resnet_50_arc
+	ModelType   string      `json:"model_type,omitempty"`
+	Model       string      `json:"model,omitempty"`
+	ModelSHA256 string      `json:"model_sha256,omitempty"`
+	SampleRate  int         `json:"sample_rate,omitempty"`
+	Threshold   float32     `json:"threshold,omitempty"`
+	Embeddings  [][]float32 `json:"embeddings"`
 }
 
-func LoadEmbeddings(filePath string) (weights [][]float32, err error) {
+// LoadReference reads a versioned reference or a legacy EfficientWord-Net reference file
+func LoadReference(filePath string) (*Reference, error) {
 	b, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read embeddings file %s: %w", filePath, err)
 	}
-	var v = new(embeddingsJSON)
+	var v = new(Reference)
 	if err = json.Unmarshal(b, v); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal embeddings file %s: %w", filePath, err)
 	}
+	if v.Version > ReferenceVersion {
+		return nil, fmt.Errorf("embeddings file %s has unsupported version %d, expected <= %d", filePath, v.Version, ReferenceVersion)
+	}
+	if len(v.Embeddings) == 0 {
+		return nil, fmt.Errorf("embeddings file %s has no embeddings", filePath)
+	}
+	if v.Wakeword == "" {
+		v.Wakeword = WakewordName(filePath)
+	}
+	return v, nil
+}
+
+func LoadEmbeddings(filePath string) (weights [][]float32, err error) {
+	v, err := LoadReference(filePath)
+	if err != nil {
+		return nil, err
+	}
 	return v.Embeddings, nil
 }
+
+// SaveReference writes the reference in the current format
+func SaveReference(filePath string, ref *Reference) error {
+	ref.Version = ReferenceVersion
+	b, err := json.Marshal(ref)
+	if err != nil {
+		return fmt.Errorf("failed to marshal embeddings: %w", err)
+	}
+	if err = os.WriteFile(filePath, b, 0644); err != nil {
+		return fmt.Errorf("failed to write embeddings file %s: %w", filePath, err)
+	}
+	return nil
+}
+
+// Verify fails when the reference was built for a different model or sample rate,
+// legacy references carry no checksum and are accepted as is
+func (r *Reference) Verify(modelPath, modelSHA256 string) error {
+	if r.ModelSHA256 != "" && r.ModelSHA256 != modelSHA256 {
+		return fmt.Errorf("wakeword %s was built for model %s (sha256 %s) but %s has sha256 %s",
+			r.Wakeword, r.Model, r.ModelSHA256, filepath.Base(modelPath), modelSHA256)
+	}
+	if r.SampleRate != 0 && r.SampleRate != sampleRate {
+		return fmt.Errorf("wakeword %s was built at %dHz but the model runs at %dHz", r.Wakeword, r.SampleRate, sampleRate)
+	}
+	return nil
+}
+
+// fileSHA256 returns the hex encoded sha256 checksum of a file
+func fileSHA256(filePath string) (sum string, err error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", filePath, err)
+	}
+	defer func() {
+		err = multierr.Combine(err, f.Close())
+	}()
+	var h = sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to checksum %s: %w", filePath, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,54 @@
+package hotword
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadLegacyReference(t *testing.T) {
+	for _, path := range []string{"../../model/hotword/computer_ref.json", "../../model/hotword/alexa_ref.json"} {
+		ref, err := LoadReference(path)
+		require.NoError(t, err, "failed to load %s", path)
+		require.Zero(t, ref.Version)
+		require.Equal(t, "resnet_50_arc", ref.ModelType)
+		require.Equal(t, WakewordName(path), ref.Wakeword)
+		require.NoError(t, ref.Verify(OnnxModelPath(), "any"), "legacy references carry no checksum")
+	}
+}
+
+func TestReferenceRoundTrip(t *testing.T) {
+	var (
+		path = filepath.Join(t.TempDir(), "snowgirl_ref.json")
+		ref  = &Reference{
+			Wakeword:    "hey snowgirl",
+			Model:       "resnet_qint8.onnx",
+			ModelSHA256: "abc",
+			SampleRate:  sampleRate,
+			Threshold:   0.85,
+			Embeddings:  [][]float32{{0.1, 0.2}},
+		}
+	)
+	require.NoError(t, SaveReference(path, ref))
+	loaded, err := LoadReference(path)
+	require.NoError(t, err)
+	require.Equal(t, ReferenceVersion, loaded.Version)
+	require.Equal(t, ref, loaded)
+
+	wakeword, err := LoadWakeword(path, 0)
+	require.NoError(t, err)
+	require.Equal(t, "hey snowgirl", wakeword.Name)
+	require.Equal(t, float32(0.85), wakeword.Threshold, "expected the suggested threshold")
+
+	require.NoError(t, loaded.Verify(OnnxModelPath(), "abc"))
+	require.ErrorContains(t, loaded.Verify(OnnxModelPath(), "def"), "was built for model")
+}
+
+func TestReferenceUnsupportedVersion(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "future_ref.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"version": 99, "embeddings": [[0.1]]}`), 0644))
+	_, err := LoadReference(path)
+	require.ErrorContains(t, err, "unsupported version")
+}
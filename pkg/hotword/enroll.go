@@ -0,0 +1,80 @@
+package hotword
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+)
+
+const (
+	MinEnrollClips = 4
+	MaxEnrollClips = 10
+)
+
+// WindowSize is the number of samples in one 1.5s detection window
+func WindowSize() int {
+	return sampleRate * 3 / 2
+}
+
+// Enroll turns recordings of a phrase into a wakeword reference, each clip is
+// trimmed of silence and centered in a detection window before inference
+func Enroll(model *Model, lms *LogMelSpectrogram, wakeword string, threshold float32, clips [][]float32) (*Reference, error) {
+	if len(clips) < MinEnrollClips || len(clips) > MaxEnrollClips {
+		return nil, fmt.Errorf("enrollment takes %d to %d clips, got %d", MinEnrollClips, MaxEnrollClips, len(clips))
+	}
+	var embeddings [][]float32
+	for i, clip := range clips {
+		vector, err := lms.AudioToVector(FitWindow(TrimSilence(clip, 0.01), WindowSize()))
+		if err != nil {
+			return nil, fmt.Errorf("clip %d: %w", i, err)
+		}
+		embedding, err := model.ProcessFrame(vector)
+		if err != nil {
+			return nil, fmt.Errorf("clip %d: %w", i, err)
+		}
+		embeddings = append(embeddings, embedding)
+	}
+	return &Reference{
+		Version:     ReferenceVersion,
+		Wakeword:    wakeword,
+		Model:       filepath.Base(model.networkPath),
+		ModelSHA256: model.Checksum(),
+		SampleRate:  sampleRate,
+		Threshold:   threshold,
+		Embeddings:  embeddings,
+	}, nil
+}
+
+// TrimSilence removes leading and trailing 10ms blocks with an rms below the threshold
+func TrimSilence(pcm []float32, threshold float64) []float32 {
+	var (
+		block      = sampleRate / 100
+		start, end = 0, len(pcm)
+	)
+	for start+block <= end && rms(pcm[start:start+block]) < threshold {
+		start += block
+	}
+	for end-block >= start && rms(pcm[end-block:end]) < threshold {
+		end -= block
+	}
+	return pcm[start:end]
+}
+
+// FitWindow centers the pcm in a window of the given size, cropping or zero padding both ends
+func FitWindow(pcm []float32, size int) []float32 {
+	if len(pcm) >= size {
+		var offset = (len(pcm) - size) / 2
+		return pcm[offset : offset+size]
+	}
+	var window = make([]float32, size)
+	copy(window[(size-len(pcm))/2:], pcm)
+	return window
+}
+
+func rms(pcm []float32) float64 {
+	var sum float64
+	for _, s := range pcm {
+		sum += float64(s) * float64(s)
+	}
+	return math.Sqrt(sum / float64(len(pcm)))
+}
@@ -0,0 +1,24 @@
+package hotword
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFitWindow(t *testing.T) {
+	var speech = make([]float32, 320)
+	for i := range speech {
+		speech[i] = 0.5
+	}
+	var clip = append(append(make([]float32, 800), speech...), make([]float32, 480)...)
+
+	trimmed := TrimSilence(clip, 0.01)
+	require.Equal(t, speech, trimmed)
+
+	window := FitWindow(trimmed, 1000)
+	require.Len(t, window, 1000)
+	require.Equal(t, speech, window[340:660], "expected clip to be centered")
+
+	require.Len(t, FitWindow(clip, 1000), 1000)
+}
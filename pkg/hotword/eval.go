@@ -0,0 +1,113 @@
+package hotword
+
+import (
+	"time"
+)
+
+// Trial holds the window scores of one labelled clip
+type Trial struct {
+	Positive bool
+	Scores   []float32
+	Duration time.Duration
+}
+
+// ROCPoint is the error rate of a wakeword at one threshold, plotting false reject rate
+// over false accept rate gives the DET curve
+type ROCPoint struct {
+	Threshold float32 `json:"threshold"`
+	// FalseAcceptRate is the fraction of negative clips with at least one false accept
+	FalseAcceptRate float64 `json:"false_accept_rate"`
+	// FalseAcceptsPerHour counts runs of consecutive windows above threshold in negative audio
+	FalseAcceptsPerHour float64 `json:"false_accepts_per_hour"`
+	// FalseRejectRate is the fraction of positive clips with no window above threshold
+	FalseRejectRate float64 `json:"false_reject_rate"`
+}
+
+// Evaluation summarises the accuracy of one wakeword reference over labelled clips
+type Evaluation struct {
+	Wakeword      string     `json:"wakeword"`
+	Reference     string     `json:"reference"`
+	Positives     int        `json:"positives"`
+	Negatives     int        `json:"negatives"`
+	NegativeHours float64    `json:"negative_hours"`
+	Points        []ROCPoint `json:"points"`
+	Recommended   ROCPoint   `json:"recommended"`
+}
+
+// Thresholds returns the thresholds from lo to hi in steps
+func Thresholds(lo, hi, step float32) (thresholds []float32) {
+	for i := 0; lo+float32(i)*step <= hi+step/2; i++ {
+		thresholds = append(thresholds, lo+float32(i)*step)
+	}
+	return thresholds
+}
+
+// Evaluate computes the error rates at every threshold and recommends the threshold
+// with the lowest false reject rate that stays within maxFAPerHour
+func Evaluate(wakeword string, trials []Trial, thresholds []float32, maxFAPerHour float64) Evaluation {
+	var e = Evaluation{Wakeword: wakeword}
+	for _, trial := range trials {
+		if trial.Positive {
+			e.Positives++
+		} else {
+			e.Negatives++
+			e.NegativeHours += trial.Duration.Hours()
+		}
+	}
+	for _, threshold := range thresholds {
+		var point = ROCPoint{Threshold: threshold}
+		var falseAccepts, acceptedClips, rejectedClips int
+		for _, trial := range trials {
+			accepts := countAccepts(trial.Scores, threshold)
+			switch {
+			case trial.Positive && accepts == 0:
+				rejectedClips++
+			case !trial.Positive && accepts > 0:
+				acceptedClips++
+				falseAccepts += accepts
+			}
+		}
+		if e.Positives > 0 {
+			point.FalseRejectRate = float64(rejectedClips) / float64(e.Positives)
+		}
+		if e.Negatives > 0 {
+			point.FalseAcceptRate = float64(acceptedClips) / float64(e.Negatives)
+		}
+		if e.NegativeHours > 0 {
+			point.FalseAcceptsPerHour = float64(falseAccepts) / e.NegativeHours
+		}
+		e.Points = append(e.Points, point)
+	}
+	e.Recommended = recommend(e.Points, maxFAPerHour)
+	return e
+}
+
+// countAccepts counts the runs of consecutive scores above the threshold,
+// since overlapping windows of one utterance would otherwise count several times
+func countAccepts(scores []float32, threshold float32) (accepts int) {
+	var above bool
+	for _, score := range scores {
+		if score > threshold && !above {
+			accepts++
+		}
+		above = score > threshold
+	}
+	return accepts
+}
+
+func recommend(points []ROCPoint, maxFAPerHour float64) (best ROCPoint) {
+	var found bool
+	for _, p := range points {
+		if p.FalseAcceptsPerHour > maxFAPerHour {
+			continue
+		}
+		if !found || p.FalseRejectRate <= best.FalseRejectRate {
+			best, found = p, true
+		}
+	}
+	if !found && len(points) > 0 {
+		// nothing meets the budget, the strictest threshold is the least bad
+		best = points[len(points)-1]
+	}
+	return best
+}
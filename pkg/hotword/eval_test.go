@@ -0,0 +1,35 @@
+package hotword
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluate(t *testing.T) {
+	var trials = []Trial{
+		{Positive: true, Scores: []float32{0.6, 0.95, 0.92}, Duration: time.Second},
+		{Positive: true, Scores: []float32{0.6, 0.85, 0.7}, Duration: time.Second},
+		{Positive: false, Scores: []float32{0.5, 0.88, 0.89, 0.5, 0.88}, Duration: 30 * time.Minute},
+		{Positive: false, Scores: []float32{0.5, 0.6}, Duration: 30 * time.Minute},
+	}
+	e := Evaluate("computer", trials, []float32{0.8, 0.9}, 1)
+	require.Equal(t, 2, e.Positives)
+	require.Equal(t, 2, e.Negatives)
+	require.InDelta(t, 1, e.NegativeHours, 1e-9)
+	require.Equal(t, []ROCPoint{
+		{Threshold: 0.8, FalseAcceptRate: 0.5, FalseAcceptsPerHour: 2, FalseRejectRate: 0},
+		{Threshold: 0.9, FalseAcceptRate: 0, FalseAcceptsPerHour: 0, FalseRejectRate: 0.5},
+	}, e.Points)
+	require.Equal(t, float32(0.9), e.Recommended.Threshold, "expected the threshold within the false accept budget")
+
+	e = Evaluate("computer", trials, []float32{0.8, 0.9}, 5)
+	require.Equal(t, float32(0.8), e.Recommended.Threshold, "expected the lowest false reject rate")
+}
+
+func TestThresholds(t *testing.T) {
+	thresholds := Thresholds(0.5, 0.99, 0.01)
+	require.Len(t, thresholds, 50)
+	require.InDelta(t, 0.99, thresholds[len(thresholds)-1], 1e-6)
+}
@@ -2,7 +2,9 @@ package hotword
 
 import (
 	"fmt"
+	"sync"
 
+	ortlib "github.com/algo-boyz/snowgirl/pkg/onnx"
 	"github.com/algo-boyz/snowgirl/pkg/state"
 	onnx "github.com/yalue/onnxruntime_go"
 	"go.uber.org/multierr"
@@ -19,37 +21,102 @@ type Model struct {
 	InputInfo   []onnx.InputOutputInfo
 	OutputInfo  []onnx.InputOutputInfo
 	Embeddings  [][]float32
+	checksum    string
+	// session and its tensors live as long as the model and are reused by every frame
+	session *onnx.AdvancedSession
+	input   *onnx.Tensor[float32]
+	output  *onnx.Tensor[float32]
+	mu      sync.Mutex
 }
 
 func NewModel(ctx state.Context, onnxPath, hotwordNetPath string, embeddings [][]float32) (m *Model, err error) {
-	onnx.SetSharedLibraryPath(onnxPath)
-	if err = onnx.InitializeEnvironment(); err != nil {
-		return nil, fmt.Errorf("failed to init onnx lib: %w", err)
+	if err = ortlib.Acquire(onnxPath); err != nil {
+		return nil, err
 	}
 	inputs, outputs, err := onnx.GetInputOutputInfo(hotwordNetPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get net info for %s: %w", hotwordNetPath, err)
+		return nil, multierr.Combine(fmt.Errorf("failed to get net info for %s: %w", hotwordNetPath, err), ortlib.Release())
 	}
 	printInfo(hotwordNetPath, inputs, outputs)
+	checksum, err := fileSHA256(hotwordNetPath)
+	if err != nil {
+		return nil, multierr.Combine(err, ortlib.Release())
+	}
 	options, err := getOptions()
+	if err != nil {
+		return nil, multierr.Combine(err, ortlib.Release())
+	}
 	m = &Model{
 		InputInfo:   inputs,
 		OutputInfo:  outputs,
 		Options:     options,
 		Embeddings:  embeddings,
 		networkPath: hotwordNetPath,
+		checksum:    checksum,
+	}
+	if err = m.newSession(); err != nil {
+		return nil, multierr.Combine(err, m.Destroy())
 	}
 	go ctx.Defer(func() {
-		if err = m.Destroy(); err != nil {
+		if err := m.Destroy(); err != nil {
 			fmt.Printf("failed to destroy eff-word-net: %s\n", err)
 		}
 		fmt.Println("eff-word-net exit")
 	})
-	return m, err
+	return m, nil
+}
+
+// newSession allocates the input and output tensors once and binds them to a single session
+func (m *Model) newSession() (err error) {
+	if m.input, err = onnx.NewEmptyTensor[float32](m.InputInfo[0].Dimensions); err != nil {
+		return fmt.Errorf("failed to create input tensor: %w", err)
+	}
+	if m.output, err = onnx.NewEmptyTensor[float32](m.OutputInfo[0].Dimensions); err != nil {
+		return fmt.Errorf("failed to create output tensor: %w", err)
+	}
+	m.session, err = onnx.NewAdvancedSession(
+		m.networkPath,
+		[]string{m.InputInfo[0].Name},
+		[]string{m.OutputInfo[0].Name},
+		[]onnx.ArbitraryTensor{m.input},
+		[]onnx.ArbitraryTensor{m.output},
+		m.Options,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create onnx session: %w", err)
+	}
+	return nil
+}
+
+// Checksum returns the sha256 of the .onnx file the model was loaded from
+func (m *Model) Checksum() string {
+	return m.checksum
+}
+
+// Verify fails when a wakeword reference was built for a different model
+func (m *Model) Verify(ref *Reference) error {
+	return ref.Verify(m.networkPath, m.checksum)
 }
 
-func (m *Model) Destroy() error {
-	return multierr.Combine(m.Options.Destroy(), onnx.DestroyEnvironment())
+// Destroy releases the session, its tensors and the onnx environment, it is safe to call twice
+func (m *Model) Destroy() (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Options == nil {
+		return nil
+	}
+	if m.session != nil {
+		err = multierr.Append(err, m.session.Destroy())
+	}
+	if m.input != nil {
+		err = multierr.Append(err, m.input.Destroy())
+	}
+	if m.output != nil {
+		err = multierr.Append(err, m.output.Destroy())
+	}
+	err = multierr.Combine(err, m.Options.Destroy(), ortlib.Release())
+	m.session, m.input, m.output, m.Options = nil, nil, nil, nil
+	return err
 }
 
 func getOptions() (options *onnx.SessionOptions, err error) {
@@ -67,48 +134,23 @@ func getOptions() (options *onnx.SessionOptions, err error) {
 	return options, nil
 }
 
+// ProcessFrame copies the vectorized frame into the preallocated input tensor,
+// runs the session and returns a copy of the output embedding
 func (m *Model) ProcessFrame(frame []float32) (distances []float32, err error) {
-	input, err := onnx.NewTensor(m.InputInfo[0].Dimensions, frame)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create input tensor: %w", err)
-	}
-	defer func() {
-		if err != nil {
-			err = multierr.Combine(err, input.Destroy())
-		}
-	}()
-	output, err := onnx.NewEmptyTensor[float32](m.OutputInfo[0].Dimensions)
-	if err != nil {
-		err = fmt.Errorf("failed to create output tensor: %w", err)
-		return nil, err
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.session == nil {
+		return nil, fmt.Errorf("eff-word net session is destroyed")
 	}
-	defer func() {
-		if err != nil {
-			err = multierr.Combine(err, output.Destroy())
-		}
-	}()
-	session, err := onnx.NewAdvancedSession(
-		m.networkPath,
-		[]string{m.InputInfo[0].Name},
-		[]string{m.OutputInfo[0].Name},
-		[]onnx.ArbitraryTensor{input},
-		[]onnx.ArbitraryTensor{output},
-		m.Options,
-	)
-	if err != nil {
-		err = fmt.Errorf("failed to create onnx session: %w", err)
-		return nil, err
+	var input = m.input.GetData()
+	if len(frame) != len(input) {
+		return nil, fmt.Errorf("frame size %d does not match input tensor size %d", len(frame), len(input))
 	}
-	defer func() {
-		if err != nil {
-			err = multierr.Combine(err, session.Destroy())
-		}
-	}()
-	if err = session.Run(); err != nil {
-		err = fmt.Errorf("failed to run eff-word net: %w", err)
-		return nil, err
+	copy(input, frame)
+	if err = m.session.Run(); err != nil {
+		return nil, fmt.Errorf("failed to run eff-word net: %w", err)
 	}
-	return output.GetData(), nil
+	return append([]float32(nil), m.output.GetData()...), nil
 }
 
 func printInfo(hotwordNetPath string, inputs, outputs []onnx.InputOutputInfo) {
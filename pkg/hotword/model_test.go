@@ -0,0 +1,111 @@
+package hotword
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/algo-boyz/snowgirl/pkg/onnx"
+	"github.com/algo-boyz/snowgirl/pkg/state"
+	"github.com/stretchr/testify/require"
+)
+
+var testModelPath = "../../" + OnnxModelPath()
+
+func newTestModel(tb testing.TB) *Model {
+	tb.Helper()
+	for _, path := range []string{onnx.LibPath(), testModelPath} {
+		if _, err := os.Stat(path); err != nil {
+			tb.Skipf("onnx runtime or model not installed: %s", err)
+		}
+	}
+	model, err := NewModel(state.NewContext(), onnx.LibPath(), testModelPath, nil)
+	require.NoError(tb, err, "failed to init onnx session")
+	tb.Cleanup(func() {
+		require.NoError(tb, model.Destroy(), "failed to destroy onnx session")
+	})
+	return model
+}
+
+func testFrame() []float32 {
+	var frame = make([]float32, 64*149)
+	for i := range frame {
+		frame[i] = float32(i%149) / 149
+	}
+	return frame
+}
+
+func BenchmarkProcessFrame(b *testing.B) {
+	var (
+		model = newTestModel(b)
+		frame = testFrame()
+	)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := model.ProcessFrame(frame); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAudioToVector(b *testing.B) {
+	var (
+		lms = DefaultLogMelSpectrogram()
+		pcm = make([]float32, sampleRate*3/2)
+	)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := lms.AudioToVector(pcm); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestProcessFrameSoak checks that reusing one session keeps memory flat
+func TestProcessFrameSoak(t *testing.T) {
+	if testing.Short() {
+		t.Skip("soak test skipped in short mode")
+	}
+	var (
+		model  = newTestModel(t)
+		frame  = testFrame()
+		warmup = 200
+		frames = 5000
+	)
+	for i := 0; i < warmup; i++ {
+		_, err := model.ProcessFrame(frame)
+		require.NoError(t, err)
+	}
+	heapBefore, rssBefore := memUsage(t)
+	for i := 0; i < frames; i++ {
+		_, err := model.ProcessFrame(frame)
+		require.NoError(t, err)
+	}
+	heapAfter, rssAfter := memUsage(t)
+	t.Logf("heap %d -> %d bytes, rss %d -> %d bytes over %d frames", heapBefore, heapAfter, rssBefore, rssAfter, frames)
+	require.Less(t, heapAfter, heapBefore+1<<20, "go heap grew over %d frames", frames)
+	if rssBefore > 0 {
+		require.Less(t, rssAfter, rssBefore+16<<20, "resident memory grew over %d frames", frames)
+	}
+}
+
+// memUsage returns the live go heap and, on linux, the resident set size
+// which also covers memory allocated by the onnx runtime
+func memUsage(t *testing.T) (heap, rss uint64) {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	b, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return stats.HeapAlloc, 0
+	}
+	fields := strings.Fields(string(b))
+	require.True(t, len(fields) > 1, "unexpected statm format %q", b)
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	require.NoError(t, err)
+	return stats.HeapAlloc, pages * uint64(os.Getpagesize())
+}
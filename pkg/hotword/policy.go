@@ -0,0 +1,79 @@
+package hotword
+
+import (
+	"fmt"
+	"time"
+)
+
+// Policy confirms a wakeword once Required of the last Window scores cross its threshold,
+// then suppresses the same wakeword for the Refractory period, like EfficientWord-Net's relaxation_time
+type Policy struct {
+	Required   int
+	Window     int
+	Refractory time.Duration
+}
+
+// DefaultPolicy fires on the first window above threshold and ignores the overlapping
+// windows of the same utterance
+func DefaultPolicy() Policy {
+	return Policy{
+		Required:   1,
+		Window:     1,
+		Refractory: 2 * time.Second,
+	}
+}
+
+// Validate checks that the policy can be satisfied
+func (p Policy) Validate() error {
+	if p.Required < 1 || p.Window < p.Required {
+		return fmt.Errorf("invalid detection policy: requires %d of %d windows", p.Required, p.Window)
+	}
+	if p.Refractory < 0 {
+		return fmt.Errorf("invalid detection policy: negative refractory period %s", p.Refractory)
+	}
+	return nil
+}
+
+// policyState tracks the recent threshold crossings of a single wakeword
+type policyState struct {
+	history   []bool
+	next      int
+	lastFired time.Time
+}
+
+func newPolicyState(p Policy) policyState {
+	return policyState{history: make([]bool, p.Window)}
+}
+
+// confirm records whether the window at the given time crossed the threshold
+// and reports if the wakeword is confirmed
+func (s *policyState) confirm(p Policy, at time.Time, triggered bool) bool {
+	s.history[s.next] = triggered
+	s.next = (s.next + 1) % len(s.history)
+	if !triggered {
+		return false
+	}
+	var count int
+	for _, t := range s.history {
+		if t {
+			count++
+		}
+	}
+	if count < p.Required {
+		return false
+	}
+	if !s.lastFired.IsZero() && at.Sub(s.lastFired) < p.Refractory {
+		return false
+	}
+	s.lastFired = at
+	s.reset()
+	return true
+}
+
+// reset forgets the crossings but keeps the refractory period running
+func (s *policyState) reset() {
+	for i := range s.history {
+		s.history[i] = false
+	}
+	s.next = 0
+}
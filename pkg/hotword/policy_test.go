@@ -0,0 +1,55 @@
+package hotword
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy(t *testing.T) {
+	var (
+		start = time.Now()
+		hop   = 750 * time.Millisecond
+	)
+	tests := []struct {
+		name      string
+		policy    Policy
+		triggered []bool
+		detected  []bool
+	}{
+		{
+			name:      "overlapping windows fire once",
+			policy:    Policy{Required: 1, Window: 1, Refractory: 2 * time.Second},
+			triggered: []bool{true, true, true, false, true},
+			detected:  []bool{true, false, false, false, true},
+		},
+		{
+			name:      "two of three",
+			policy:    Policy{Required: 2, Window: 3},
+			triggered: []bool{true, false, true, false, false, true, false},
+			detected:  []bool{false, false, true, false, false, false, false},
+		},
+		{
+			name:      "no refractory refires",
+			policy:    Policy{Required: 1, Window: 1},
+			triggered: []bool{true, true},
+			detected:  []bool{true, true},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var state = newPolicyState(test.policy)
+			for i, triggered := range test.triggered {
+				at := start.Add(time.Duration(i) * hop)
+				require.Equal(t, test.detected[i], state.confirm(test.policy, at, triggered), "window %d", i)
+			}
+		})
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	require.NoError(t, DefaultPolicy().Validate())
+	require.Error(t, Policy{Required: 3, Window: 2}.Validate())
+	require.Error(t, Policy{Required: 0, Window: 2}.Validate())
+}
@@ -235,12 +235,16 @@ func (lms *LogMelSpectrogram) AudioToVector(inpAudio []float32) ([]float32, erro
 // ScoreVector calculates the maximum cosine similarity score between an input vector
 // and a set of embeddings
 func (m *Model) ScoreVector(inputVector []float32) float32 {
+	return scoreEmbeddings(inputVector, m.Embeddings)
+}
+
+func scoreEmbeddings(inputVector []float32, embeddings [][]float32) float32 {
 	if len(inputVector) != 2048 {
 		return .0 // Dimension mismatch
 	}
 	// Compute cosine similarities for each embedding
 	var cosineSimilarities []float32
-	for _, embedding := range m.Embeddings {
+	for _, embedding := range embeddings {
 		// Compute raw dot product without explicit normalization
 		dotProd := dotProduct(inputVector, embedding)
 		// Normalize score to [0, 1] range
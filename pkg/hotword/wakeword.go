@@ -0,0 +1,47 @@
+package hotword
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Wakeword is a named set of reference embeddings with its own detection threshold
+type Wakeword struct {
+	Name       string
+	Threshold  float32
+	Embeddings [][]float32
+	Reference  *Reference
+}
+
+// LoadWakeword reads a reference file, legacy files are named after the file,
+// e.g. model/hotword/computer_ref.json becomes "computer". A zero threshold falls back
+// to the threshold suggested by the reference, then to the DefaultThreshold
+func LoadWakeword(filePath string, threshold float32) (*Wakeword, error) {
+	ref, err := LoadReference(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if threshold == 0 {
+		threshold = ref.Threshold
+	}
+	if threshold == 0 {
+		threshold = DefaultThreshold
+	}
+	return &Wakeword{
+		Name:       ref.Wakeword,
+		Threshold:  threshold,
+		Embeddings: ref.Embeddings,
+		Reference:  ref,
+	}, nil
+}
+
+// WakewordName derives the wakeword name from a reference file path
+func WakewordName(filePath string) string {
+	var name = strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+	return strings.TrimSuffix(name, "_ref")
+}
+
+// Score returns the maximum similarity between an inference output and the wakeword embeddings
+func (w *Wakeword) Score(inputVector []float32) float32 {
+	return scoreEmbeddings(inputVector, w.Embeddings)
+}
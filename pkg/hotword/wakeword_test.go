@@ -0,0 +1,61 @@
+package hotword
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectorScore(t *testing.T) {
+	var output = make([]float32, 2048)
+	output[0] = 1
+	var (
+		alexa    = &Wakeword{Name: "alexa", Threshold: 0.9, Embeddings: [][]float32{make([]float32, 2048)}}
+		computer = &Wakeword{Name: "computer", Threshold: 0.9, Embeddings: [][]float32{output}}
+	)
+	detector, err := NewDetector(nil, DefaultPolicy(), alexa, computer)
+	require.NoError(t, err)
+	require.Equal(t, []Score{
+		{Wakeword: "alexa", Confidence: 0.5},
+		{Wakeword: "computer", Confidence: 1, Triggered: true, Detected: true},
+	}, detector.Score(time.Now(), output))
+}
+
+func TestDetectorScoreChannels(t *testing.T) {
+	var (
+		silence  = make([]float32, 2048)
+		computer = make([]float32, 2048)
+		partial  = make([]float32, 2048)
+	)
+	computer[0] = 1
+	partial[0] = 0.9
+	detector, err := NewDetector(nil, Policy{Required: 1, Window: 1, Refractory: time.Second},
+		&Wakeword{Name: "computer", Threshold: 0.9, Embeddings: [][]float32{computer}})
+	require.NoError(t, err)
+	// the word reaches the third mic best and is confirmed once across channels
+	var now = time.Now()
+	require.Equal(t, []Score{{Wakeword: "computer", Confidence: 1, Triggered: true, Detected: true, Channel: 2}},
+		detector.ScoreChannels(now, [][]float32{silence, partial, computer}))
+	require.False(t, detector.ScoreChannels(now.Add(time.Millisecond), [][]float32{computer, computer})[0].Detected)
+}
+
+func TestDetectorReset(t *testing.T) {
+	var computer = make([]float32, 2048)
+	computer[0] = 1
+	detector, err := NewDetector(nil, DefaultPolicy(),
+		&Wakeword{Name: "computer", Threshold: 0.9, Embeddings: [][]float32{computer}})
+	require.NoError(t, err)
+	// two files scanned on clocks that both start at zero
+	var start time.Time
+	require.True(t, detector.Score(start.Add(time.Second), computer)[0].Detected)
+	detector.Reset()
+	require.True(t, detector.Score(start.Add(time.Second), computer)[0].Detected, "refractory period leaked into the next file")
+}
+
+func TestLoadWakeword(t *testing.T) {
+	wakeword, err := LoadWakeword("../../model/hotword/alexa_ref.json", 0.9)
+	require.NoError(t, err, "failed to load wakeword")
+	require.Equal(t, "alexa", wakeword.Name)
+	require.NotEmpty(t, wakeword.Embeddings)
+}
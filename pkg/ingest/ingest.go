@@ -0,0 +1,33 @@
+// Package ingest accepts pcm streamed by network clients, every connection becomes an audio source
+package ingest
+
+import (
+	"github.com/algo-boyz/snowgirl/pkg/audio"
+)
+
+// maxFrameSize bounds a single TCP frame or websocket message
+const maxFrameSize = 1 << 20
+
+// Conn is the audio of one client connection
+type Conn struct {
+	// Protocol is tcp, rtp or ws
+	Protocol string
+	Remote   string
+	// Format of the pcm read by Source
+	Format audio.RawFormat
+	// Source ends when the client disconnects, closing it drops the connection
+	Source audio.AudioSource
+}
+
+// Handler is run on its own goroutine for every connection until it returns
+type Handler func(c *Conn)
+
+// ErrorHandler is called for clients that fail before their connection is handled,
+// e.g. without a valid format, a nil ErrorHandler ignores them
+type ErrorHandler func(err error)
+
+func (h ErrorHandler) report(err error) {
+	if h != nil {
+		h(err)
+	}
+}
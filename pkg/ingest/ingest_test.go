@@ -0,0 +1,262 @@
+package ingest
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/algo-boyz/snowgirl/pkg/audio"
+	"github.com/algo-boyz/snowgirl/pkg/state"
+	"github.com/coder/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// tone returns n samples exactly representable as 16-bit pcm
+func tone(n int) []float32 {
+	var samples = make([]float32, n)
+	for i := range samples {
+		samples[i] = float32(math.Round(math.Sin(float64(i)/10)*8000)) / (1 << 15)
+	}
+	return samples
+}
+
+func s16(samples []float32, order binary.ByteOrder) []byte {
+	var b = make([]byte, len(samples)*2)
+	for i, s := range samples {
+		order.PutUint16(b[i*2:], uint16(int16(s*(1<<15))))
+	}
+	return b
+}
+
+// readSource reads the source of the first connection until it ends
+func readSource(t *testing.T, conns <-chan *Conn) (*Conn, []float32) {
+	var c *Conn
+	select {
+	case c = <-conns:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no connection")
+	}
+	require.NoError(t, c.Source.Start())
+	var samples []float32
+	for {
+		chunk, err := c.Source.Read()
+		if errors.Is(err, io.EOF) {
+			return c, samples
+		}
+		require.NoError(t, err)
+		samples = append(samples, chunk...)
+	}
+}
+
+// handoff passes every connection to the test and keeps it open until the test ends
+func handoff(t *testing.T) (Handler, <-chan *Conn) {
+	var (
+		conns = make(chan *Conn, 1)
+		done  = make(chan struct{})
+	)
+	t.Cleanup(func() { close(done) })
+	return func(c *Conn) {
+		conns <- c
+		<-done
+	}, conns
+}
+
+func TestServeTCP(t *testing.T) {
+	var (
+		ctx           = state.NewContext()
+		samples       = tone(1000)
+		handle, conns = handoff(t)
+	)
+	defer ctx.Exit()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		require.NoError(t, ServeTCP(ctx, l, handle, nil))
+	}()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	var frame = func(payload []byte) {
+		require.NoError(t, binary.Write(client, binary.BigEndian, uint32(len(payload))))
+		_, err := client.Write(payload)
+		require.NoError(t, err)
+	}
+	frame([]byte("s16le:16000:1"))
+	// frames need not align with samples
+	var pcm = s16(samples, binary.LittleEndian)
+	frame(pcm[:301])
+	frame(pcm[301:])
+	frame(nil)
+
+	c, received := readSource(t, conns)
+	require.Equal(t, "tcp", c.Protocol)
+	require.Equal(t, audio.RawFormat{Encoding: audio.S16LE, SampleRate: 16000, Channels: 1}, c.Format)
+	require.Equal(t, samples, received)
+}
+
+func TestServeTCPBadFormat(t *testing.T) {
+	var (
+		ctx    = state.NewContext()
+		errs   = make(chan error, 1)
+		handle = func(c *Conn) { t.Error("unexpected connection") }
+	)
+	defer ctx.Exit()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		require.NoError(t, ServeTCP(ctx, l, handle, func(err error) { errs <- err }))
+	}()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	var format = []byte("mp3:16000:1")
+	require.NoError(t, binary.Write(client, binary.BigEndian, uint32(len(format))))
+	_, err = client.Write(format)
+	require.NoError(t, err)
+
+	select {
+	case err = <-errs:
+		require.ErrorContains(t, err, "tcp "+client.LocalAddr().String())
+	case <-time.After(time.Second):
+		t.Fatal("no error reported")
+	}
+}
+
+func rtpBytes(payloadType uint8, seq uint16, ssrc uint32, payload []byte) []byte {
+	var b = make([]byte, 12, 12+len(payload))
+	b[0] = 2 << 6
+	b[1] = payloadType
+	binary.BigEndian.PutUint16(b[2:], seq)
+	binary.BigEndian.PutUint32(b[4:], uint32(seq)*160)
+	binary.BigEndian.PutUint32(b[8:], ssrc)
+	return append(b, payload...)
+}
+
+func TestServeRTP(t *testing.T) {
+	var (
+		ctx           = state.NewContext()
+		samples       = tone(800)
+		handle, conns = handoff(t)
+	)
+	defer ctx.Exit()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		require.NoError(t, ServeRTP(ctx, pc, audio.RawFormat{SampleRate: 16000, Channels: 1}, 100*time.Millisecond, handle, nil))
+	}()
+
+	client, err := net.Dial("udp", pc.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	// packet 3 is lost and packet 2 repeated late
+	for _, seq := range []uint16{1, 2, 4, 2, 5} {
+		var payload = s16(samples[int(seq-1)*160:int(seq)*160], binary.BigEndian)
+		_, err := client.Write(rtpBytes(96, 65534+seq, 0xfeed, payload))
+		require.NoError(t, err)
+	}
+
+	// the sender ends once it is idle
+	c, received := readSource(t, conns)
+	require.Equal(t, "rtp", c.Protocol)
+	require.True(t, strings.HasSuffix(c.Remote, "/0000feed"), c.Remote)
+	var want = append(append([]float32(nil), samples[:320]...), make([]float32, 160)...)
+	want = append(want, samples[480:800]...)
+	require.Equal(t, want, received)
+}
+
+func TestServeRTPRejected(t *testing.T) {
+	var (
+		ctx   = state.NewContext()
+		conns = make(chan *Conn, 4)
+		errs  = make(chan error, 4)
+	)
+	defer ctx.Exit()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	var handle = func(c *Conn) {
+		conns <- c
+		_ = c.Source.Close()
+	}
+	go func() {
+		require.NoError(t, ServeRTP(ctx, pc, audio.RawFormat{SampleRate: 16000, Channels: 1}, time.Second, handle, func(err error) { errs <- err }))
+	}()
+
+	client, err := net.Dial("udp", pc.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	var payload = make([]byte, 320)
+	// pcmu is reported once and never becomes a connection
+	for seq := uint16(1); seq <= 3; seq++ {
+		_, err := client.Write(rtpBytes(0, seq, 1, payload))
+		require.NoError(t, err)
+	}
+	select {
+	case err = <-errs:
+		require.ErrorContains(t, err, "unsupported payload type 0")
+	case <-time.After(time.Second):
+		t.Fatal("no error reported")
+	}
+
+	// a sender whose source was closed is ignored until idle instead of reconnecting
+	for seq := uint16(1); seq <= 5; seq++ {
+		_, err := client.Write(rtpBytes(96, seq, 2, payload))
+		require.NoError(t, err)
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	require.Len(t, conns, 1)
+	require.Len(t, errs, 0)
+}
+
+func TestParseRTP(t *testing.T) {
+	var packet = rtpBytes(11, 7, 1, []byte{1, 2, 3, 4, 0, 0, 3})
+	// one csrc, a one word extension and three bytes of padding
+	packet[0] |= 0x20 | 0x10 | 1
+	packet = append(packet[:12], append([]byte{0, 0, 0, 9, 0xbe, 0xde, 0, 1, 0, 0, 0, 0}, packet[12:]...)...)
+	p, err := parseRTP(packet)
+	require.NoError(t, err)
+	require.Equal(t, uint8(11), p.payloadType)
+	require.Equal(t, uint16(7), p.seq)
+	require.Equal(t, []byte{1, 2, 3, 4}, p.payload)
+
+	_, err = parseRTP([]byte{0x80, 0})
+	require.Error(t, err)
+}
+
+func TestWebSocket(t *testing.T) {
+	var (
+		samples       = tone(1000)
+		handle, conns = handoff(t)
+		server        = httptest.NewServer(WebSocketHandler(handle, nil))
+	)
+	defer server.Close()
+	client, _, err := websocket.Dial(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	require.NoError(t, client.Write(context.Background(), websocket.MessageText, []byte("f32le:16000:2")))
+	// stereo of the tone and silence is downmixed to half the tone
+	var pcm = make([]byte, len(samples)*8)
+	for i, s := range samples {
+		binary.LittleEndian.PutUint32(pcm[i*8:], math.Float32bits(s))
+	}
+	for offset := 0; offset < len(pcm); offset += 1024 {
+		require.NoError(t, client.Write(context.Background(), websocket.MessageBinary, pcm[offset:min(len(pcm), offset+1024)]))
+	}
+	go client.Close(websocket.StatusNormalClosure, "")
+
+	c, received := readSource(t, conns)
+	require.Equal(t, "ws", c.Protocol)
+	require.Equal(t, 2, c.Format.Channels)
+	require.Len(t, received, len(samples))
+	for i := range samples {
+		require.Equal(t, samples[i]/2, received[i], "sample %d", i)
+	}
+}
@@ -0,0 +1,231 @@
+package ingest
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/algo-boyz/snowgirl/pkg/audio"
+	"github.com/algo-boyz/snowgirl/pkg/state"
+)
+
+const (
+	// rtpQueue is the number of packets buffered per sender before new ones are dropped
+	rtpQueue = 256
+	// maxRTPGap is the number of lost packets filled with silence, longer gaps are skipped
+	maxRTPGap = 50
+)
+
+// ServeRTP receives RTP packets with an L16 payload, big endian 16-bit pcm, until the context
+// exits. Every sender address and SSRC becomes a connection, ended once it is silent for idle.
+// The static payload types 10 and 11 are 44.1kHz stereo and mono, dynamic ones use format,
+// senders of other types are reported and ignored until idle like those whose source was closed.
+// Lost packets are filled with silence and late ones dropped
+func ServeRTP(ctx state.Context, pc net.PacketConn, format audio.RawFormat, idle time.Duration, handle Handler, onError ErrorHandler) error {
+	format.Encoding = audio.S16LE
+	if err := format.Validate(); err != nil {
+		return err
+	}
+	go ctx.Defer(func() {
+		_ = pc.Close()
+	})
+	var (
+		streams = make(map[string]*rtpStream)
+		// rejected holds when ignored senders were last seen
+		rejected = make(map[string]time.Time)
+		buffer   = make([]byte, 1<<16)
+	)
+	defer func() {
+		for _, s := range streams {
+			s.end()
+		}
+	}()
+	for {
+		if err := pc.SetReadDeadline(time.Now().Add(idle)); err != nil {
+			return err
+		}
+		n, addr, err := pc.ReadFrom(buffer)
+		var now = time.Now()
+		for key, s := range streams {
+			if now.Sub(s.lastSeen) > idle || s.isClosed() {
+				if now.Sub(s.lastSeen) <= idle {
+					rejected[key] = s.lastSeen
+				}
+				s.end()
+				delete(streams, key)
+			}
+		}
+		for key, lastSeen := range rejected {
+			if now.Sub(lastSeen) > idle {
+				delete(rejected, key)
+			}
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("rtp read: %w", err)
+		}
+		packet, err := parseRTP(buffer[:n])
+		if err != nil {
+			continue
+		}
+		var key = fmt.Sprintf("%s/%08x", addr, packet.ssrc)
+		if _, ok := rejected[key]; ok {
+			rejected[key] = now
+			continue
+		}
+		s, ok := streams[key]
+		if !ok {
+			f, ok := rtpFormat(packet.payloadType, format)
+			if !ok {
+				onError.report(fmt.Errorf("rtp %s: unsupported payload type %d", key, packet.payloadType))
+				rejected[key] = now
+				continue
+			}
+			s = newRTPStream(packet.seq - 1)
+			source, err := audio.NewReaderSource(s, f)
+			if err != nil {
+				return err
+			}
+			streams[key] = s
+			go handle(&Conn{Protocol: "rtp", Remote: key, Format: f, Source: source})
+		}
+		s.lastSeen = now
+		s.receive(packet)
+	}
+}
+
+// rtpFormat is the format of an L16 payload type, false for other encodings
+func rtpFormat(payloadType uint8, format audio.RawFormat) (audio.RawFormat, bool) {
+	switch {
+	case payloadType == 10:
+		format.SampleRate, format.Channels = 44100, 2
+	case payloadType == 11:
+		format.SampleRate, format.Channels = 44100, 1
+	case payloadType < 96:
+		return format, false
+	}
+	return format, true
+}
+
+type rtpPacket struct {
+	payloadType uint8
+	seq         uint16
+	ssrc        uint32
+	payload     []byte
+}
+
+// parseRTP skips the csrc list, header extension and padding of a version 2 packet
+func parseRTP(b []byte) (rtpPacket, error) {
+	if len(b) < 12 || b[0]>>6 != 2 {
+		return rtpPacket{}, fmt.Errorf("not an rtp packet")
+	}
+	var (
+		padding   = b[0]&0x20 != 0
+		extension = b[0]&0x10 != 0
+		offset    = 12 + 4*int(b[0]&0x0f)
+		end       = len(b)
+	)
+	if extension {
+		if end < offset+4 {
+			return rtpPacket{}, fmt.Errorf("truncated rtp header extension")
+		}
+		offset += 4 + 4*int(binary.BigEndian.Uint16(b[offset+2:]))
+	}
+	if padding && end > 0 {
+		end -= int(b[end-1])
+	}
+	if offset > end {
+		return rtpPacket{}, fmt.Errorf("truncated rtp packet")
+	}
+	return rtpPacket{
+		payloadType: b[1] & 0x7f,
+		seq:         binary.BigEndian.Uint16(b[2:]),
+		ssrc:        binary.BigEndian.Uint32(b[8:]),
+		payload:     b[offset:end],
+	}, nil
+}
+
+// rtpStream queues the payloads of one sender as little endian pcm for its source
+type rtpStream struct {
+	queue    chan []byte
+	lastSeq  uint16
+	lastSeen time.Time
+	pending  []byte
+	mu       sync.Mutex
+	closed   bool
+	ended    bool
+}
+
+func newRTPStream(lastSeq uint16) *rtpStream {
+	return &rtpStream{queue: make(chan []byte, rtpQueue), lastSeq: lastSeq}
+}
+
+// receive drops late and duplicate packets and fills short gaps with silence
+func (s *rtpStream) receive(p rtpPacket) {
+	var gap = int16(p.seq - s.lastSeq)
+	if gap <= 0 {
+		return
+	}
+	s.lastSeq = p.seq
+	var pcm = make([]byte, len(p.payload))
+	for i := 0; i+1 < len(pcm); i += 2 {
+		pcm[i], pcm[i+1] = p.payload[i+1], p.payload[i]
+	}
+	if gap > 1 && gap <= maxRTPGap {
+		s.push(make([]byte, int(gap-1)*len(pcm)))
+	}
+	s.push(pcm)
+}
+
+// push queues without blocking the other senders, packets are dropped when the source falls behind
+func (s *rtpStream) push(pcm []byte) {
+	select {
+	case s.queue <- pcm:
+	default:
+	}
+}
+
+// end tells the source the sender is gone once it read the queue
+func (s *rtpStream) end() {
+	if !s.ended {
+		s.ended = true
+		close(s.queue)
+	}
+}
+
+func (s *rtpStream) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *rtpStream) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		pcm, ok := <-s.queue
+		if !ok {
+			return 0, io.EOF
+		}
+		s.pending = pcm
+	}
+	var n = copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// Close stops queueing, the stream is removed with the next packet or idle timeout
+func (s *rtpStream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
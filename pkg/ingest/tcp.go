@@ -0,0 +1,113 @@
+package ingest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/algo-boyz/snowgirl/pkg/audio"
+	"github.com/algo-boyz/snowgirl/pkg/state"
+)
+
+// ServeTCP accepts framed pcm until the context exits. Every frame is a 4 byte big endian length
+// followed by its payload, the first frame holds the format as text, e.g. s16le:16000:1, and the
+// following ones interleaved pcm. A zero length frame or closing the connection ends the stream
+func ServeTCP(ctx state.Context, l net.Listener, handle Handler, onError ErrorHandler) error {
+	go ctx.Defer(func() {
+		_ = l.Close()
+	})
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("tcp accept: %w", err)
+		}
+		go serveTCP(conn, handle, onError)
+	}
+}
+
+func serveTCP(conn net.Conn, handle Handler, onError ErrorHandler) {
+	var frames = &frameReader{r: bufio.NewReader(conn), conn: conn}
+	format, err := frames.header()
+	if err != nil {
+		onError.report(fmt.Errorf("tcp %s: %w", conn.RemoteAddr(), err))
+		_ = conn.Close()
+		return
+	}
+	source, err := audio.NewReaderSource(frames, format)
+	if err != nil {
+		onError.report(fmt.Errorf("tcp %s: %w", conn.RemoteAddr(), err))
+		_ = conn.Close()
+		return
+	}
+	defer conn.Close()
+	handle(&Conn{Protocol: "tcp", Remote: conn.RemoteAddr().String(), Format: format, Source: source})
+}
+
+// frameReader reads the payloads of consecutive frames as one stream
+type frameReader struct {
+	r         *bufio.Reader
+	conn      net.Conn
+	remaining uint32
+	ended     bool
+}
+
+// header reads the format frame
+func (f *frameReader) header() (audio.RawFormat, error) {
+	size, err := f.next()
+	if err != nil {
+		return audio.RawFormat{}, fmt.Errorf("missing format frame: %w", err)
+	}
+	var b = make([]byte, size)
+	if _, err = io.ReadFull(f.r, b); err != nil {
+		return audio.RawFormat{}, fmt.Errorf("missing format frame: %w", err)
+	}
+	f.remaining = 0
+	return audio.ParseRawFormat(string(b))
+}
+
+// next reads the length of the next frame
+func (f *frameReader) next() (uint32, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(f.r, header[:]); err != nil {
+		return 0, err
+	}
+	var size = binary.BigEndian.Uint32(header[:])
+	if size > maxFrameSize {
+		return 0, fmt.Errorf("frame of %d bytes exceeds %d", size, maxFrameSize)
+	}
+	f.remaining = size
+	return size, nil
+}
+
+func (f *frameReader) Read(p []byte) (int, error) {
+	for f.remaining == 0 {
+		if f.ended {
+			return 0, io.EOF
+		}
+		size, err := f.next()
+		if errors.Is(err, io.EOF) || (err == nil && size == 0) {
+			f.ended = true
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.r.Read(p[:min(len(p), int(f.remaining))])
+	f.remaining -= uint32(n)
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// Close drops the connection
+func (f *frameReader) Close() error {
+	return f.conn.Close()
+}
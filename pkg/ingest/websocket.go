@@ -0,0 +1,86 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/algo-boyz/snowgirl/pkg/audio"
+	"github.com/coder/websocket"
+)
+
+// WebSocketHandler upgrades every request to a websocket connection. The first message is the
+// format as text, e.g. s16le:16000:1, and every following binary message holds interleaved pcm.
+// A normal close ends the stream
+func WebSocketHandler(handle Handler, onError ErrorHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			onError.report(fmt.Errorf("ws %s: %w", r.RemoteAddr, err))
+			return
+		}
+		conn.SetReadLimit(maxFrameSize)
+		var messages = &messageReader{ctx: r.Context(), conn: conn}
+		format, err := messages.header()
+		if err == nil {
+			var source *audio.ReaderSource
+			if source, err = audio.NewReaderSource(messages, format); err == nil {
+				handle(&Conn{Protocol: "ws", Remote: r.RemoteAddr, Format: format, Source: source})
+				_ = messages.Close()
+				return
+			}
+		}
+		onError.report(fmt.Errorf("ws %s: %w", r.RemoteAddr, err))
+		_ = conn.Close(websocket.StatusUnsupportedData, err.Error())
+	})
+}
+
+// messageReader reads consecutive binary messages as one stream
+type messageReader struct {
+	ctx     context.Context
+	conn    *websocket.Conn
+	pending []byte
+	ended   bool
+}
+
+// header reads the format message
+func (m *messageReader) header() (audio.RawFormat, error) {
+	typ, b, err := m.conn.Read(m.ctx)
+	if err != nil {
+		return audio.RawFormat{}, fmt.Errorf("missing format message: %w", err)
+	}
+	if typ != websocket.MessageText {
+		return audio.RawFormat{}, fmt.Errorf("expected the format as a text message")
+	}
+	return audio.ParseRawFormat(string(b))
+}
+
+func (m *messageReader) Read(p []byte) (int, error) {
+	for len(m.pending) == 0 {
+		if m.ended {
+			return 0, io.EOF
+		}
+		typ, b, err := m.conn.Read(m.ctx)
+		if websocket.CloseStatus(err) == websocket.StatusNormalClosure || errors.Is(err, io.EOF) {
+			m.ended = true
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if typ != websocket.MessageBinary {
+			return 0, fmt.Errorf("expected pcm as binary messages")
+		}
+		m.pending = b
+	}
+	var n = copy(p, m.pending)
+	m.pending = m.pending[n:]
+	return n, nil
+}
+
+// Close ends the connection normally
+func (m *messageReader) Close() error {
+	return m.conn.Close(websocket.StatusNormalClosure, "")
+}
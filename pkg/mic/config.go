@@ -0,0 +1,61 @@
+// Package mic captures audio from input devices through portaudio, builds tagged noportaudio
+// leave portaudio out and fail to open devices, e.g. to run the file pipeline in CI
+package mic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Device describes an audio input device, Index is its position in the portaudio device list
+type Device struct {
+	Index             int
+	Name              string
+	HostAPI           string
+	Channels          int
+	DefaultSampleRate float64
+	Default           bool
+}
+
+// Config selects the input device, its capture rate and channels
+type Config struct {
+	// Device is an index or a case insensitive name substring, empty uses the default input device
+	Device string
+	// SampleRate to capture at, zero captures at the model rate when supported
+	// and at the device rate otherwise
+	SampleRate int
+	// Channels to capture, zero captures mono
+	Channels int
+}
+
+// selectDevice picks an input device by index or by name substring, an empty spec picks the default
+func selectDevice(devices []Device, spec string) (Device, error) {
+	if index, err := strconv.Atoi(spec); err == nil {
+		for _, d := range devices {
+			if d.Index == index {
+				return d, nil
+			}
+		}
+		return Device{}, fmt.Errorf("no input device with index %d, see the devices command", index)
+	}
+	var matches []Device
+	for _, d := range devices {
+		if spec == "" && d.Default || spec != "" && strings.Contains(strings.ToLower(d.Name), strings.ToLower(spec)) {
+			matches = append(matches, d)
+		}
+	}
+	switch {
+	case len(matches) == 0 && spec == "":
+		return Device{}, fmt.Errorf("no default input device, see the devices command")
+	case len(matches) == 0:
+		return Device{}, fmt.Errorf("no input device named like %q, see the devices command", spec)
+	case len(matches) > 1 && spec != "":
+		var names = make([]string, len(matches))
+		for i, d := range matches {
+			names[i] = fmt.Sprintf("%d: %s", d.Index, d.Name)
+		}
+		return Device{}, fmt.Errorf("input device %q is ambiguous, it matches %s", spec, strings.Join(names, ", "))
+	}
+	return matches[0], nil
+}
@@ -0,0 +1,51 @@
+//go:build !noportaudio
+
+package mic
+
+import (
+	"fmt"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// InputDevices lists every device with input channels
+func InputDevices() ([]Device, error) {
+	if err := portaudio.Initialize(); err != nil {
+		return nil, fmt.Errorf("portaudio.Initialize: %w", err)
+	}
+	defer portaudio.Terminate()
+	devices, _, err := inputDevices()
+	return devices, err
+}
+
+// inputDevices lists the input devices along with their portaudio info, portaudio must be initialized
+func inputDevices() ([]Device, []*portaudio.DeviceInfo, error) {
+	infos, err := portaudio.Devices()
+	if err != nil {
+		return nil, nil, fmt.Errorf("portaudio.Devices: %w", err)
+	}
+	// names repeat across host APIs, portaudio hands out the same info for the same device
+	var defaultInfo *portaudio.DeviceInfo
+	if info, err := portaudio.DefaultInputDevice(); err == nil {
+		defaultInfo = info
+	}
+	var devices []Device
+	for i, info := range infos {
+		if info.MaxInputChannels == 0 {
+			continue
+		}
+		var hostAPI string
+		if info.HostApi != nil {
+			hostAPI = info.HostApi.Name
+		}
+		devices = append(devices, Device{
+			Index:             i,
+			Name:              info.Name,
+			HostAPI:           hostAPI,
+			Channels:          info.MaxInputChannels,
+			DefaultSampleRate: info.DefaultSampleRate,
+			Default:           info == defaultInfo,
+		})
+	}
+	return devices, infos, nil
+}
@@ -0,0 +1,40 @@
+package mic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectDevice(t *testing.T) {
+	var devices = []Device{
+		{Index: 0, Name: "HDA Intel PCH: ALC3246 Analog (hw:0,0)", HostAPI: "ALSA", Channels: 2, DefaultSampleRate: 44100, Default: true},
+		{Index: 3, Name: "ReSpeaker 4 Mic Array (UAC1.0): USB Audio (hw:2,0)", HostAPI: "ALSA", Channels: 6, DefaultSampleRate: 16000},
+		{Index: 4, Name: "HDMI Capture: USB Audio (hw:3,0)", HostAPI: "ALSA", Channels: 2, DefaultSampleRate: 48000},
+	}
+	for _, tc := range []struct {
+		spec  string
+		index int
+		err   string
+	}{
+		{spec: "", index: 0},
+		{spec: "3", index: 3},
+		{spec: "respeaker", index: 3},
+		{spec: "HDMI", index: 4},
+		{spec: "1", err: "no input device with index 1"},
+		{spec: "usb audio", err: "ambiguous"},
+		{spec: "webcam", err: "no input device named like"},
+	} {
+		t.Run(tc.spec, func(t *testing.T) {
+			device, err := selectDevice(devices, tc.spec)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.index, device.Index)
+		})
+	}
+	_, err := selectDevice(devices[1:], "")
+	require.ErrorContains(t, err, "no default input device")
+}
@@ -0,0 +1,32 @@
+//go:build noportaudio
+
+package mic
+
+import (
+	"errors"
+
+	"github.com/algo-boyz/snowgirl/pkg/audio"
+	"github.com/algo-boyz/snowgirl/pkg/state"
+)
+
+var errNoPortAudio = errors.New("built without portaudio, input devices are unavailable")
+
+// Source cannot be opened in builds without portaudio
+type Source struct{}
+
+func NewSource(ctx state.Context, cfg Config, bufferSecs float32) (*Source, error) {
+	return nil, errNoPortAudio
+}
+
+func NewStream(ctx state.Context, cfg Config, windowLengthSecs, slidingWindowSecs float32) (*audio.AudioStream, error) {
+	return nil, errNoPortAudio
+}
+
+func InputDevices() ([]Device, error) {
+	return nil, errNoPortAudio
+}
+
+func (m *Source) Start() error             { return errNoPortAudio }
+func (m *Source) Read() ([]float32, error) { return nil, errNoPortAudio }
+func (m *Source) SampleRate() int          { return 0 }
+func (m *Source) Close() error             { return nil }
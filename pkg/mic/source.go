@@ -0,0 +1,193 @@
+//go:build !noportaudio
+
+package mic
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/algo-boyz/snowgirl/pkg/audio"
+	"github.com/algo-boyz/snowgirl/pkg/state"
+	"github.com/gordonklaus/portaudio"
+)
+
+// Source captures mono or interleaved multi-channel audio from an input device
+type Source struct {
+	cfg        Config
+	bufferSecs float32
+	mu         sync.Mutex
+	stream     *portaudio.Stream
+	buffer     []float32
+	rate       int
+	overflows  atomic.Uint64
+}
+
+// NewSource opens the configured input device, reads return bufferSecs of audio
+func NewSource(ctx state.Context, cfg Config, bufferSecs float32) (*Source, error) {
+	// Initialize PortAudio
+	if err := portaudio.Initialize(); err != nil {
+		return nil, fmt.Errorf("portaudio.Initialize: %w", err)
+	}
+	var m = &Source{
+		cfg:        cfg,
+		bufferSecs: bufferSecs,
+	}
+	if err := m.open(); err != nil {
+		return nil, err
+	}
+	go ctx.Defer(func() {
+		fmt.Println("portaudio exiting")
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.stream != nil {
+			if err := m.stream.Stop(); err != nil {
+				fmt.Printf("failed to stop audio stream: %s\n", err)
+			}
+			if err := m.stream.Close(); err != nil {
+				fmt.Printf("failed to close audio stream: %s\n", err)
+			}
+		}
+		if err := portaudio.Terminate(); err != nil {
+			fmt.Printf("failed to terminate portaudio: %s\n", err)
+		}
+	})
+	return m, nil
+}
+
+// open selects the device and opens a stream on it, portaudio must be initialized
+func (m *Source) open() error {
+	devices, infos, err := inputDevices()
+	if err != nil {
+		return err
+	}
+	device, err := selectDevice(devices, m.cfg.Device)
+	if err != nil {
+		return err
+	}
+	var (
+		deviceInfo = infos[device.Index]
+		channels   = m.Channels()
+	)
+	if channels > device.Channels {
+		return fmt.Errorf("input device %d %q has %d channels, %d requested", device.Index, device.Name, device.Channels, channels)
+	}
+	inputParams := portaudio.LowLatencyParameters(deviceInfo, nil)
+	inputParams.Input.Channels = channels
+	inputParams.Output.Channels = 0
+
+	// Capture at the requested rate, or at the model rate falling back to the device rate
+	var captureRate = m.cfg.SampleRate
+	if captureRate == 0 {
+		captureRate = audio.SampleRate
+	}
+	inputParams.SampleRate = float64(captureRate)
+	inputParams.FramesPerBuffer = round(m.bufferSecs * float32(captureRate))
+	var buffer = make([]float32, inputParams.FramesPerBuffer*channels)
+	if err = portaudio.IsFormatSupported(inputParams, buffer); err != nil {
+		if m.cfg.SampleRate != 0 {
+			return fmt.Errorf("input device %d %q does not support capturing at %dHz, its default rate is %gHz: %w",
+				device.Index, device.Name, m.cfg.SampleRate, device.DefaultSampleRate, err)
+		}
+		captureRate = int(deviceInfo.DefaultSampleRate)
+		inputParams.SampleRate = deviceInfo.DefaultSampleRate
+		inputParams.FramesPerBuffer = round(m.bufferSecs * float32(captureRate))
+		buffer = make([]float32, inputParams.FramesPerBuffer*channels)
+		fmt.Printf("%s does not support %dHz, resampling from %dHz\n", deviceInfo.Name, audio.SampleRate, captureRate)
+	}
+	fmt.Printf("capturing %d channels from %s at %dHz\n", channels, deviceInfo.Name, captureRate)
+	stream, err := portaudio.OpenStream(inputParams, buffer)
+	if err != nil {
+		return fmt.Errorf("portaudio.OpenStream: %w", err)
+	}
+	m.stream, m.buffer, m.rate = stream, buffer, captureRate
+	return nil
+}
+
+func (m *Source) Start() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stream.Start()
+}
+
+// Read counts input overflows and returns the audio captured after them
+func (m *Source) Read() ([]float32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stream == nil {
+		return nil, fmt.Errorf("input device is closed")
+	}
+	err := m.stream.Read()
+	if errors.Is(err, portaudio.InputOverflowed) {
+		m.overflows.Add(1)
+	} else if err != nil {
+		return nil, err
+	}
+	// portaudio reuses the buffer for every read
+	return append([]float32(nil), m.buffer...), nil
+}
+
+// Reopen restarts portaudio so unplugged devices are found again, then opens and starts
+// the configured device, which may now capture at another rate
+func (m *Source) Reopen() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stream != nil {
+		// the stream of a lost device fails to close cleanly, it is dropped either way
+		_ = m.stream.Close()
+		m.stream = nil
+	}
+	if err := portaudio.Terminate(); err != nil {
+		return fmt.Errorf("portaudio.Terminate: %w", err)
+	}
+	if err := portaudio.Initialize(); err != nil {
+		return fmt.Errorf("portaudio.Initialize: %w", err)
+	}
+	if err := m.open(); err != nil {
+		return err
+	}
+	return m.stream.Start()
+}
+
+// Overflows returns how often capture lost input because it was not read in time
+func (m *Source) Overflows() uint64 {
+	return m.overflows.Load()
+}
+
+// Channels is the number of interleaved channels returned by Read
+func (m *Source) Channels() int {
+	return max(1, m.cfg.Channels)
+}
+
+func (m *Source) SampleRate() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rate
+}
+
+// Close stops capture, the stream is closed when the context exits
+func (m *Source) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stream == nil {
+		return nil
+	}
+	return m.stream.Stop()
+}
+
+// NewStream creates a sliding window stream of an input device
+func NewStream(ctx state.Context, cfg Config, windowLengthSecs, slidingWindowSecs float32) (*audio.AudioStream, error) {
+	source, err := NewSource(ctx, cfg, slidingWindowSecs)
+	if err != nil {
+		return nil, err
+	}
+	return audio.NewAudioStream(ctx, source, windowLengthSecs, slidingWindowSecs), nil
+}
+
+func round(f float32) int {
+	if f < 0 {
+		return int(f - 0.5)
+	}
+	return int(f + 0.5)
+}
@@ -0,0 +1,42 @@
+package onnx
+
+import (
+	"fmt"
+	"sync"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+var (
+	envMu   sync.Mutex
+	envRefs int
+)
+
+// Acquire initializes the onnx runtime environment on first use so several models,
+// e.g. the hotword and the voice activity nets, can share it
+func Acquire(libPath string) error {
+	envMu.Lock()
+	defer envMu.Unlock()
+	if envRefs == 0 {
+		ort.SetSharedLibraryPath(libPath)
+		if err := ort.InitializeEnvironment(); err != nil {
+			return fmt.Errorf("failed to init onnx lib: %w", err)
+		}
+	}
+	envRefs++
+	return nil
+}
+
+// Release destroys the onnx runtime environment once the last model released it
+func Release() error {
+	envMu.Lock()
+	defer envMu.Unlock()
+	if envRefs == 0 {
+		return nil
+	}
+	envRefs--
+	if envRefs > 0 {
+		return nil
+	}
+	return ort.DestroyEnvironment()
+}
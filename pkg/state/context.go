@@ -38,6 +38,38 @@ type ctx struct {
 	sigChan chan os.Signal // use a separate signal channel per context
 }
 
+// WithCancel derives a context that ends with its parent or when cancel is called, e.g. for
+// the lifetime of a network client. Cancel waits for the closers registered on the child,
+// and the parent's Exit waits for them too
+func WithCancel(parent Context) (child Context, cancel func()) {
+	inner, cancelInner := context.WithCancel(parent)
+	var c = &ctx{
+		Context: inner,
+		cancel:  cancelInner,
+		sigChan: make(chan os.Signal, 1),
+	}
+	var done = func() {}
+	if p, ok := parent.(*ctx); ok {
+		p.mu.Lock()
+		p.wg.Add(1)
+		p.mu.Unlock()
+		done = p.wg.Done
+	}
+	// unlike Defer no goroutine waits for the child to end
+	var closed = make(chan struct{})
+	context.AfterFunc(inner, func() {
+		defer close(closed)
+		defer done()
+		c.mu.Lock()
+		c.wg.Wait()
+		c.mu.Unlock()
+	})
+	return c, func() {
+		c.cancel()
+		<-closed
+	}
+}
+
 // Defer spawns a goroutine to wait for all pending closers to finish.
 func (ctx *ctx) Defer(fn func()) {
 	ctx.mu.Lock()
@@ -0,0 +1,27 @@
+package state
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithCancel(t *testing.T) {
+	var (
+		parent     = NewContext()
+		goroutines = runtime.NumGoroutine()
+	)
+	for range 100 {
+		child, cancel := WithCancel(parent)
+		go child.Defer(func() {})
+		cancel()
+	}
+	// cancelled children leave nothing waiting on the parent
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > goroutines && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	require.Equal(t, goroutines, runtime.NumGoroutine())
+	parent.Exit()
+}
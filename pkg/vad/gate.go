@@ -0,0 +1,82 @@
+package vad
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Decision is the voice activity of the newest audio handed to the gate
+type Decision struct {
+	// Speech is set while speech was heard within the hangover period
+	Speech bool
+	// Probability is the highest speech probability of the newest audio
+	Probability float32
+	Time        time.Time
+}
+
+// speechModel scores vad chunks with state carried between them, implemented by Model
+type speechModel interface {
+	Probability(chunk []float32) (float32, error)
+	Reset()
+}
+
+// Gate splits incoming audio into vad chunks and keeps speech open for a hangover period,
+// so a detection window that still holds a spoken word is not gated off
+type Gate struct {
+	model     speechModel
+	threshold float32
+	hangover  int
+	pending   []float32
+	silence   int // samples since the last chunk above threshold
+	mu        sync.Mutex
+}
+
+// NewGate gates on the model's speech probability
+func NewGate(model *Model, threshold float32, hangover time.Duration) *Gate {
+	return newGate(model, threshold, hangover)
+}
+
+func newGate(model speechModel, threshold float32, hangover time.Duration) *Gate {
+	var hangoverSamples = int(hangover.Seconds() * sampleRate)
+	return &Gate{
+		model:     model,
+		threshold: threshold,
+		hangover:  hangoverSamples,
+		silence:   hangoverSamples + 1,
+	}
+}
+
+// Process scores the new samples captured up to the given time, samples that do not
+// fill a whole chunk are kept for the next call
+func (g *Gate) Process(at time.Time, samples []float32) (d Decision, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	d.Time = at
+	g.pending = append(g.pending, samples...)
+	var offset int
+	for ; offset+ChunkSize <= len(g.pending); offset += ChunkSize {
+		p, err := g.model.Probability(g.pending[offset : offset+ChunkSize])
+		if err != nil {
+			return d, fmt.Errorf("vad: %w", err)
+		}
+		d.Probability = max(d.Probability, p)
+		if p >= g.threshold {
+			g.silence = 0
+		} else {
+			g.silence += ChunkSize
+		}
+	}
+	g.pending = append(g.pending[:0], g.pending[offset:]...)
+	d.Speech = g.silence <= g.hangover
+	return d, nil
+}
+
+// Reset forgets buffered audio, any speech heard before and the model's recurrent state
+func (g *Gate) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.pending = g.pending[:0]
+	g.silence = g.hangover + 1
+	g.model.Reset()
+}
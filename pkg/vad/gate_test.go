@@ -0,0 +1,99 @@
+package vad
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// funcModel scores chunks without state
+type funcModel func(chunk []float32) (float32, error)
+
+func (f funcModel) Probability(chunk []float32) (float32, error) { return f(chunk) }
+func (funcModel) Reset()                                         {}
+
+// recurrentModel keeps hearing speech once a loud chunk passed, like a stale recurrent state
+type recurrentModel struct {
+	heard bool
+}
+
+func (m *recurrentModel) Probability(chunk []float32) (float32, error) {
+	if chunk[0] > 0 {
+		m.heard = true
+	}
+	if m.heard {
+		return 0.9, nil
+	}
+	return 0.1, nil
+}
+
+func (m *recurrentModel) Reset() {
+	m.heard = false
+}
+
+func TestGate(t *testing.T) {
+	var (
+		speech bool
+		chunks int
+		gate   = newGate(funcModel(func(chunk []float32) (float32, error) {
+			chunks++
+			if speech {
+				return 0.9, nil
+			}
+			return 0.1, nil
+		}), 0.5, 100*time.Millisecond)
+		hop = make([]float32, 4000) // 250ms at 16kHz
+		now = time.Now()
+	)
+	d, err := gate.Process(now, hop)
+	require.NoError(t, err)
+	require.False(t, d.Speech, "expected silence")
+	require.Equal(t, 7, chunks, "expected 7 whole chunks")
+
+	speech = true
+	d, err = gate.Process(now, hop)
+	require.NoError(t, err)
+	require.True(t, d.Speech)
+	require.Equal(t, float32(0.9), d.Probability)
+	require.Equal(t, 15, chunks, "expected the leftover samples to be carried over")
+
+	speech = false
+	d, err = gate.Process(now, hop[:1024])
+	require.NoError(t, err)
+	require.True(t, d.Speech, "expected speech to be held for the hangover")
+
+	d, err = gate.Process(now, hop)
+	require.NoError(t, err)
+	require.False(t, d.Speech, "expected the hangover to expire")
+
+	speech = true
+	_, err = gate.Process(now, hop)
+	require.NoError(t, err)
+	gate.Reset()
+	speech = false
+	d, err = gate.Process(now, hop[:512])
+	require.NoError(t, err)
+	require.False(t, d.Speech, "expected reset to forget speech")
+}
+
+func TestGateResetsModel(t *testing.T) {
+	var (
+		speech  = make([]float32, 4000)
+		silence = make([]float32, 4000)
+		now     = time.Now()
+		used    = newGate(&recurrentModel{}, 0.5, 0)
+		fresh   = newGate(&recurrentModel{}, 0.5, 0)
+	)
+	for i := range speech {
+		speech[i] = 0.5
+	}
+	_, err := used.Process(now, speech)
+	require.NoError(t, err)
+	used.Reset()
+	d, err := used.Process(now, silence)
+	require.NoError(t, err)
+	want, err := fresh.Process(now, silence)
+	require.NoError(t, err)
+	require.Equal(t, want, d, "expected the audio before the reset to be forgotten by the model")
+}
@@ -0,0 +1,155 @@
+package vad
+
+import (
+	"fmt"
+	"sync"
+
+	ortlib "github.com/algo-boyz/snowgirl/pkg/onnx"
+	"github.com/algo-boyz/snowgirl/pkg/state"
+	onnx "github.com/yalue/onnxruntime_go"
+	"go.uber.org/multierr"
+)
+
+const (
+	sampleRate = 16000
+	// ChunkSize is the number of samples silero vad scores at once, 32ms at 16kHz
+	ChunkSize = 512
+	// contextSize samples of the previous chunk are prepended to each chunk
+	contextSize = 64
+	stateSize   = 2 * 1 * 128
+)
+
+func OnnxModelPath() string {
+	return "model/vad/silero_vad.onnx"
+}
+
+// Model runs the silero vad v5 net on 32ms chunks, carrying its recurrent state
+// and the context of the previous chunk from one call to the next
+type Model struct {
+	networkPath string
+	options     *onnx.SessionOptions
+	session     *onnx.AdvancedSession
+	input       *onnx.Tensor[float32]
+	state       *onnx.Tensor[float32]
+	rate        *onnx.Tensor[int64]
+	output      *onnx.Tensor[float32]
+	stateN      *onnx.Tensor[float32]
+	mu          sync.Mutex
+}
+
+func NewModel(ctx state.Context, onnxPath, silenceNetPath string) (m *Model, err error) {
+	if err = ortlib.Acquire(onnxPath); err != nil {
+		return nil, err
+	}
+	m = &Model{networkPath: silenceNetPath}
+	if err = m.newSession(); err != nil {
+		return nil, multierr.Combine(err, m.destroy(), ortlib.Release())
+	}
+	go ctx.Defer(func() {
+		if err := m.Destroy(); err != nil {
+			fmt.Printf("failed to destroy silero vad: %s\n", err)
+		}
+		fmt.Println("silero vad exit")
+	})
+	return m, nil
+}
+
+func (m *Model) newSession() (err error) {
+	if m.options, err = onnx.NewSessionOptions(); err != nil {
+		return fmt.Errorf("failed to create onnx session options: %w", err)
+	}
+	if err = m.options.SetIntraOpNumThreads(1); err != nil {
+		return fmt.Errorf("failed to set intra op threads: %w", err)
+	}
+	if err = m.options.SetInterOpNumThreads(1); err != nil {
+		return fmt.Errorf("failed to set inter op threads: %w", err)
+	}
+	if m.input, err = onnx.NewEmptyTensor[float32](onnx.NewShape(1, contextSize+ChunkSize)); err != nil {
+		return fmt.Errorf("failed to create input tensor: %w", err)
+	}
+	if m.state, err = onnx.NewEmptyTensor[float32](onnx.NewShape(2, 1, 128)); err != nil {
+		return fmt.Errorf("failed to create state tensor: %w", err)
+	}
+	if m.rate, err = onnx.NewTensor(onnx.NewShape(1), []int64{sampleRate}); err != nil {
+		return fmt.Errorf("failed to create sample rate tensor: %w", err)
+	}
+	if m.output, err = onnx.NewEmptyTensor[float32](onnx.NewShape(1, 1)); err != nil {
+		return fmt.Errorf("failed to create output tensor: %w", err)
+	}
+	if m.stateN, err = onnx.NewEmptyTensor[float32](onnx.NewShape(2, 1, 128)); err != nil {
+		return fmt.Errorf("failed to create state output tensor: %w", err)
+	}
+	m.session, err = onnx.NewAdvancedSession(
+		m.networkPath,
+		[]string{"input", "state", "sr"},
+		[]string{"output", "stateN"},
+		[]onnx.ArbitraryTensor{m.input, m.state, m.rate},
+		[]onnx.ArbitraryTensor{m.output, m.stateN},
+		m.options,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create onnx session for %s: %w", m.networkPath, err)
+	}
+	return nil
+}
+
+// Probability returns the speech probability of a chunk of ChunkSize samples
+func (m *Model) Probability(chunk []float32) (float32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.session == nil {
+		return 0, fmt.Errorf("silero vad session is destroyed")
+	}
+	if len(chunk) != ChunkSize {
+		return 0, fmt.Errorf("chunk size %d does not match %d", len(chunk), ChunkSize)
+	}
+	var input = m.input.GetData()
+	// keep the tail of the previous chunk as context
+	copy(input, input[ChunkSize:])
+	copy(input[contextSize:], chunk)
+	if err := m.session.Run(); err != nil {
+		return 0, fmt.Errorf("failed to run silero vad: %w", err)
+	}
+	copy(m.state.GetData(), m.stateN.GetData())
+	return m.output.GetData()[0], nil
+}
+
+// Reset clears the recurrent state and context
+func (m *Model) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.session == nil {
+		return
+	}
+	m.input.ZeroContents()
+	m.state.ZeroContents()
+}
+
+// Destroy releases the session and the onnx environment, it is safe to call twice
+func (m *Model) Destroy() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.options == nil {
+		return nil
+	}
+	return multierr.Combine(m.destroy(), ortlib.Release())
+}
+
+func (m *Model) destroy() (err error) {
+	if m.session != nil {
+		err = multierr.Append(err, m.session.Destroy())
+	}
+	for _, t := range []*onnx.Tensor[float32]{m.input, m.state, m.output, m.stateN} {
+		if t != nil {
+			err = multierr.Append(err, t.Destroy())
+		}
+	}
+	if m.rate != nil {
+		err = multierr.Append(err, m.rate.Destroy())
+	}
+	if m.options != nil {
+		err = multierr.Append(err, m.options.Destroy())
+	}
+	m.session, m.input, m.state, m.rate, m.output, m.stateN, m.options = nil, nil, nil, nil, nil, nil, nil
+	return err
+}
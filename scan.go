@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/algo-boyz/snowgirl/pkg/audio"
+	"github.com/algo-boyz/snowgirl/pkg/hotword"
+	"github.com/algo-boyz/snowgirl/pkg/state"
+	"go.uber.org/multierr"
+)
+
+// scanDetection is a wakeword found in a file, offsets are in seconds
+type scanDetection struct {
+	File       string  `json:"file"`
+	Wakeword   string  `json:"wakeword"`
+	Start      float64 `json:"start"`
+	End        float64 `json:"end"`
+	Confidence float32 `json:"confidence"`
+}
+
+// scan runs the detector over audio files without opening a mic
+//
+//	snowgirl scan -format csv model/hotword/alexa.wav model/hotword/computer.mp3
+func scan(ctx state.Context, args []string) (err error) {
+	var (
+		cmd     = flag.NewFlagSet("scan", flag.ExitOnError)
+		format  = cmd.String("format", "jsonl", "output format jsonl or csv")
+		outPath = cmd.String("out", "-", "output path, - for stdout")
+	)
+	if err = cmd.Parse(args); err != nil {
+		return err
+	}
+	var out io.Writer = os.Stdout
+	if *outPath != "-" {
+		var f *os.File
+		if f, err = os.Create(*outPath); err != nil {
+			return fmt.Errorf("scan: %w", err)
+		}
+		defer func() {
+			err = multierr.Combine(err, f.Close())
+		}()
+		out = f
+	}
+	w, err := newScanWriter(*format, out)
+	if err != nil {
+		return err
+	}
+	_, detector, err := newDetector(ctx, config())
+	if err != nil {
+		return err
+	}
+	var lms = hotword.DefaultLogMelSpectrogram()
+	for _, filePath := range cmd.Args() {
+		err = scanFile(detector, lms, filePath, func(d scanDetection) error {
+			return w.Write(d)
+		})
+		if err != nil {
+			return multierr.Combine(fmt.Errorf("scan: %s: %w", filePath, err), w.Flush())
+		}
+	}
+	return w.Flush()
+}
+
+// scanFile slides the live detection window over a file and reports every detection
+func scanFile(detector *hotword.Detector, lms *hotword.LogMelSpectrogram, filePath string, fn func(scanDetection) error) error {
+	pcm, err := loadAudio(filePath)
+	if err != nil {
+		return err
+	}
+	detector.Reset()
+	var (
+		start    time.Time
+		duration = audio.Seconds(len(pcm))
+	)
+	return audio.SlidingWindows(pcm, windowLengthSecs, slidingWindowSecs, func(offset int, window []float32) error {
+		normalized, err := lms.AudioToVector(window)
+		if err != nil {
+			return fmt.Errorf("logMelSpec.AudioToVector: %w", err)
+		}
+		var (
+			begin = audio.Seconds(offset)
+			end   = min(audio.Seconds(offset+len(window)), duration)
+		)
+		scores, err := detector.Detect(start.Add(time.Duration(end*float64(time.Second))), normalized)
+		if err != nil {
+			return err
+		}
+		for _, score := range scores {
+			if !score.Detected {
+				continue
+			}
+			err = fn(scanDetection{
+				File:       filePath,
+				Wakeword:   score.Wakeword,
+				Start:      begin,
+				End:        end,
+				Confidence: score.Confidence,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+type scanWriter interface {
+	Write(scanDetection) error
+	Flush() error
+}
+
+func newScanWriter(format string, w io.Writer) (scanWriter, error) {
+	switch format {
+	case "jsonl":
+		return &jsonlWriter{enc: json.NewEncoder(w)}, nil
+	case "csv":
+		var c = csv.NewWriter(w)
+		if err := c.Write([]string{"file", "wakeword", "start", "end", "confidence"}); err != nil {
+			return nil, err
+		}
+		return &csvWriter{w: c}, nil
+	default:
+		return nil, fmt.Errorf("unsupported scan output format %s", format)
+	}
+}
+
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func (w *jsonlWriter) Write(d scanDetection) error {
+	return w.enc.Encode(d)
+}
+
+func (w *jsonlWriter) Flush() error {
+	return nil
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (w *csvWriter) Write(d scanDetection) error {
+	return w.w.Write([]string{
+		d.File,
+		d.Wakeword,
+		strconv.FormatFloat(d.Start, 'f', 3, 64),
+		strconv.FormatFloat(d.End, 'f', 3, 64),
+		strconv.FormatFloat(float64(d.Confidence), 'f', 4, 32),
+	})
+}
+
+func (w *csvWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
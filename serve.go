@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/algo-boyz/snowgirl/pkg/audio"
+	"github.com/algo-boyz/snowgirl/pkg/hotword"
+	"github.com/algo-boyz/snowgirl/pkg/ingest"
+	"github.com/algo-boyz/snowgirl/pkg/state"
+)
+
+// serve runs a detector with its own events for every client streaming pcm over the network
+//
+//	snowgirl serve -tcp :7000 -rtp :5004 -ws :8080
+func serve(ctx state.Context, args []string) error {
+	var (
+		cmd         = flag.NewFlagSet("serve", flag.ExitOnError)
+		tcpAddr     = cmd.String("tcp", "", "address to accept length framed pcm on, e.g. :7000")
+		rtpAddr     = cmd.String("rtp", "", "udp address to receive rtp with an L16 payload on, e.g. :5004")
+		wsAddr      = cmd.String("ws", "", "address to accept pcm as websocket binary messages on, e.g. :8080")
+		rtpRate     = cmd.Int("rtp-rate", 16000, "sample rate of rtp senders using a dynamic payload type")
+		rtpChannels = cmd.Int("rtp-channels", 1, "channels of rtp senders using a dynamic payload type")
+		rtpIdle     = cmd.Duration("rtp-idle", 2*time.Second, "silence after which an rtp sender is disconnected")
+	)
+	if err := cmd.Parse(args); err != nil {
+		return err
+	}
+	var (
+		handle  = detectConn(ctx)
+		onError = func(err error) {
+			fmt.Printf("%s %s\n", time.Now().Format(time.TimeOnly), err)
+		}
+		errs    = make(chan error, 3)
+		servers int
+	)
+	if *tcpAddr != "" {
+		l, err := net.Listen("tcp", *tcpAddr)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("accepting framed pcm on tcp %s\n", l.Addr())
+		servers++
+		go func() {
+			errs <- ingest.ServeTCP(ctx, l, handle, onError)
+		}()
+	}
+	if *rtpAddr != "" {
+		pc, err := net.ListenPacket("udp", *rtpAddr)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("receiving rtp on udp %s\n", pc.LocalAddr())
+		servers++
+		var format = audio.RawFormat{SampleRate: *rtpRate, Channels: *rtpChannels}
+		go func() {
+			errs <- ingest.ServeRTP(ctx, pc, format, *rtpIdle, handle, onError)
+		}()
+	}
+	if *wsAddr != "" {
+		l, err := net.Listen("tcp", *wsAddr)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("accepting websockets on %s\n", l.Addr())
+		servers++
+		var server = &http.Server{Handler: ingest.WebSocketHandler(handle, onError)}
+		go ctx.Defer(func() {
+			_ = server.Close()
+		})
+		go func() {
+			if err := server.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+				errs <- err
+				return
+			}
+			errs <- nil
+		}()
+	}
+	if servers == 0 {
+		return fmt.Errorf("serve: at least one of -tcp, -rtp or -ws is required")
+	}
+	for range servers {
+		if err := <-errs; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// detectConn listens to a connection with its own detector until the client disconnects
+func detectConn(ctx state.Context) ingest.Handler {
+	return func(c *ingest.Conn) {
+		fmt.Printf("%s %s connected sending %s\n", c.Protocol, c.Remote, c.Format)
+		defer fmt.Printf("%s %s disconnected\n", c.Protocol, c.Remote)
+		// the models of a connection are released when it ends rather than on exit
+		connCtx, cancel := state.WithCancel(ctx)
+		defer cancel()
+		var cfg = config()
+		cfg.Source = c.Source
+		snowgirl, err := NewSnowGirl(connCtx, cfg)
+		if err != nil {
+			fmt.Printf("%s %s: %s\n", c.Protocol, c.Remote, err)
+			_ = c.Source.Close()
+			return
+		}
+		defer func() {
+			if err := snowgirl.Close(); err != nil {
+				fmt.Printf("%s %s: %s\n", c.Protocol, c.Remote, err)
+			}
+		}()
+		snowgirl.OnDetection(func(d hotword.Detection) {
+			fmt.Printf("%s %s %s %s DETECTED! confidence: %f\n", d.Time.Format(time.TimeOnly), c.Protocol, c.Remote, d.Wakeword, d.Confidence)
+		})
+		snowgirl.OnError(func(err error) {
+			fmt.Printf("%s %s %s error: %s\n", time.Now().Format(time.TimeOnly), c.Protocol, c.Remote, err)
+		})
+		if err = snowgirl.Listen(); err != nil {
+			fmt.Printf("%s %s: %s\n", c.Protocol, c.Remote, err)
+		}
+	}
+}
@@ -1,24 +1,82 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/algo-boyz/snowgirl/pkg/audio"
 	"github.com/algo-boyz/snowgirl/pkg/hotword"
+	"github.com/algo-boyz/snowgirl/pkg/mic"
 	"github.com/algo-boyz/snowgirl/pkg/onnx"
 	"github.com/algo-boyz/snowgirl/pkg/state"
+	"github.com/algo-boyz/snowgirl/pkg/vad"
+	"go.uber.org/multierr"
 )
 
+// Detection windows are 1.5s long and slide every 0.75s
+const (
+	windowLengthSecs  = 1.5
+	slidingWindowSecs = 0.75
+)
+
+// ErrFallingBehind is published to error subscribers when detection skipped windows
+// because it could not keep up with the audio
+var ErrFallingBehind = errors.New("detection is falling behind the audio")
+
 type Config struct {
-	OnnxPath, SilenceNetPath, HotwordNetPath, HotwordEmbedPath string
+	OnnxPath, SilenceNetPath, HotwordNetPath string
+	Wakewords                                []WakewordConfig
+	Policy                                   hotword.Policy
+	// SpeechThreshold is the silero vad probability above which a chunk counts as speech,
+	// windows without speech skip hotword inference when SilenceNetPath is set
+	SpeechThreshold float32
+	// Source is the audio to listen to, nil captures from the Mic input device
+	Source audio.AudioSource
+	Mic    mic.Config
+	// Backpressure decides which windows are dropped when detection falls behind the audio
+	Backpressure audio.Backpressure
+	Clips        ClipConfig
+	// ChannelMode applies when the source has several channels, e.g. Mic.Channels
+	ChannelMode ChannelMode
+	// Array places the mics of the input channels to locate detections, nil skips locating
+	Array audio.ArrayGeometry
+	// Sinks record the whole session while detection runs, they are closed when it ends
+	Sinks []audio.Sink
+}
+
+// ChannelMode decides which channels of a multi-channel input are detected on
+type ChannelMode string
+
+const (
+	// MixChannels averages the channels and runs the detector once
+	MixChannels ChannelMode = "mix"
+	// BestChannel runs the model on every channel and confirms each wakeword on its best channel
+	BestChannel ChannelMode = "best"
+	// SNRChannel runs the detector once on the channel with the highest signal to noise ratio
+	SNRChannel ChannelMode = "snr"
+)
+
+// WakewordConfig points to a reference embeddings file and its detection threshold,
+// a zero threshold uses the one suggested by the reference
+type WakewordConfig struct {
+	EmbedPath string
+	Threshold float32
 }
 
 func DefaultConfig() Config {
 	return Config{
-		OnnxPath:         onnx.LibPath(),
-		HotwordNetPath:   hotword.OnnxModelPath(),
-		HotwordEmbedPath: hotword.EmbeddingsPath(),
+		OnnxPath:       onnx.LibPath(),
+		HotwordNetPath: hotword.OnnxModelPath(),
+		Wakewords: []WakewordConfig{
+			{EmbedPath: hotword.EmbeddingsPath()},
+		},
+		Policy:          hotword.DefaultPolicy(),
+		SpeechThreshold: 0.5,
+		Backpressure:    audio.DropOldest,
+		ChannelMode:     MixChannels,
+		Clips:           ClipConfig{PreRoll: 2 * time.Second, PostRoll: 3 * time.Second},
 	}
 }
 
@@ -26,55 +84,223 @@ type SnowGirl struct {
 	cfg          Config
 	ctx          state.Context
 	hotwordModel *hotword.Model
+	vadModel     *vad.Model
+	detector     *hotword.Detector
 	logMelSpec   *hotword.LogMelSpectrogram
-	mic          *audio.MicStream
+	vad          *vad.Gate
+	stream       *audio.AudioStream
+	pauseMu      sync.Mutex
+	paused       bool
+	resumedAt    int64 // stream position of the last resume
+	resumeTimer  *time.Timer
+	pauses       uint64 // tells a resume timer whether it still belongs to the latest pause
+	detections   broker[hotword.Detection]
+	scores       broker[hotword.FrameScores]
+	voice        broker[vad.Decision]
+	errors       broker[error]
 }
 
 func NewSnowGirl(ctx state.Context, cfg Config) (*SnowGirl, error) {
-	embeddings, err := hotword.LoadEmbeddings(cfg.HotwordEmbedPath)
-	if err != nil {
-		return nil, err
+	switch cfg.ChannelMode {
+	case MixChannels, BestChannel, SNRChannel:
+	default:
+		return nil, fmt.Errorf("unknown channel mode %q, expected %s, %s or %s", cfg.ChannelMode, MixChannels, BestChannel, SNRChannel)
+	}
+	if cfg.Array != nil {
+		if err := cfg.Array.Validate(); err != nil {
+			return nil, err
+		}
 	}
-	hotwordModel, err := hotword.NewModel(ctx, cfg.OnnxPath, cfg.HotwordNetPath, embeddings)
+	hotwordModel, detector, err := newDetector(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
-	stream, err := audio.NewMicStream(ctx, 1.5, 0.75)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create mic stream: %w", err)
+	var (
+		vadModel *vad.Model
+		gate     *vad.Gate
+	)
+	if cfg.SilenceNetPath != "" {
+		if vadModel, err = vad.NewModel(ctx, cfg.OnnxPath, cfg.SilenceNetPath); err != nil {
+			return nil, err
+		}
+		// hold speech for a whole window so every window holding a word is scored
+		gate = vad.NewGate(vadModel, cfg.SpeechThreshold, time.Duration(windowLengthSecs*float64(time.Second)))
 	}
-	if err = stream.Start(); err != nil {
-		return nil, fmt.Errorf("failed to start mic stream: %w", err)
+	var source = cfg.Source
+	if source == nil {
+		if source, err = mic.NewSource(ctx, cfg.Mic, slidingWindowSecs); err != nil {
+			return nil, fmt.Errorf("failed to create mic source: %w", err)
+		}
 	}
-	return &SnowGirl{
+	var s = &SnowGirl{
 		ctx:          ctx,
 		cfg:          cfg,
-		mic:          stream,
+		stream:       audio.NewAudioStream(ctx, source, windowLengthSecs, slidingWindowSecs),
 		hotwordModel: hotwordModel,
+		vadModel:     vadModel,
+		detector:     detector,
 		logMelSpec:   hotword.DefaultLogMelSpectrogram(),
-	}, nil
+		vad:          gate,
+	}
+	// capture errors are recovered from by the stream, subscribers are only told
+	s.stream.OnError(s.errors.publish)
+	if cfg.Clips.Dir != "" {
+		s.stream.PreRoll(float32(cfg.Clips.PreRoll.Seconds()))
+	}
+	return s, nil
 }
 
+// Close releases the models before the context exits, e.g. once a network client disconnected
+func (s *SnowGirl) Close() error {
+	var err = s.hotwordModel.Destroy()
+	if s.vadModel != nil {
+		err = multierr.Append(err, s.vadModel.Destroy())
+	}
+	return err
+}
+
+// newDetector loads the configured wakewords and shares one model between them
+func newDetector(ctx state.Context, cfg Config) (*hotword.Model, *hotword.Detector, error) {
+	var wakewords = make([]*hotword.Wakeword, len(cfg.Wakewords))
+	for i, w := range cfg.Wakewords {
+		wakeword, err := hotword.LoadWakeword(w.EmbedPath, w.Threshold)
+		if err != nil {
+			return nil, nil, err
+		}
+		wakewords[i] = wakeword
+	}
+	hotwordModel, err := hotword.NewModel(ctx, cfg.OnnxPath, cfg.HotwordNetPath, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	detector, err := hotword.NewDetector(hotwordModel, cfg.Policy, wakewords...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return hotwordModel, detector, nil
+}
+
+// Listen starts the audio source and runs hotword detection until it ends,
+// publishing the scores of every window and each detection to subscribers
 func (s *SnowGirl) Listen() (err error) {
-	time.Sleep(time.Millisecond * 500)
-	audioChan := s.mic.Subscribe()
-	defer s.mic.Unsubscribe(audioChan)
+	audioChan := s.stream.Subscribe(audio.SubscribeOptions{Backpressure: s.cfg.Backpressure})
+	defer s.stream.Unsubscribe(audioChan)
+	for _, sink := range s.cfg.Sinks {
+		// recordings wait for their writes instead of leaving gaps
+		s.stream.Attach(sink, audio.SubscribeOptions{Backpressure: audio.Block})
+	}
+	if err = s.stream.Start(); err != nil {
+		return fmt.Errorf("failed to start audio stream: %w", err)
+	}
+	defer s.detections.close()
+	defer s.scores.close()
+	defer s.voice.close()
+	defer s.errors.close()
+	var (
+		hopSize = audio.Samples(slidingWindowSecs)
+		nextSeq uint64
+		clips   sync.WaitGroup
+	)
+	// clips end with the stream, saving them may still report errors
+	defer clips.Wait()
 	for frame := range audioChan {
-		normalized, err := s.logMelSpec.AudioToVector(frame)
-		if err != nil {
-			return fmt.Errorf("logMelSpec.AudioToVector: %w", err)
+		if frame.Seq != nextSeq {
+			s.errors.publish(fmt.Errorf("skipped %d windows: %w", frame.Seq-nextSeq, ErrFallingBehind))
+		}
+		nextSeq = frame.Seq + 1
+		if !s.active(frame) {
+			continue
+		}
+		if s.vad != nil {
+			// only the newest hop of the window is new audio
+			decision, err := s.vad.Process(frame.Time, frame.Samples[max(0, len(frame.Samples)-hopSize):])
+			if err != nil {
+				return err
+			}
+			s.voice.publish(decision)
+			if !decision.Speech {
+				continue
+			}
 		}
-		output, err := s.hotwordModel.ProcessFrame(normalized)
+		scores, err := s.detect(frame)
 		if err != nil {
-			return fmt.Errorf("model.ProcessFrame: %w", err)
+			return err
 		}
-		fmt.Println("mic_frame: ", len(frame), "normalized: ", len(normalized))
-		var detected string
-		var confidence = s.hotwordModel.ScoreVector(output)
-		if confidence > 0.9 {
-			detected = "DETECTED!"
+		s.scores.publish(hotword.FrameScores{Time: frame.Time, Scores: scores})
+		for _, score := range scores {
+			if !score.Detected {
+				continue
+			}
+			var d = hotword.Detection{
+				Wakeword:   score.Wakeword,
+				Confidence: score.Confidence,
+				Time:       frame.Time,
+				Audio:      frame.Samples,
+				Channel:    score.Channel,
+			}
+			if score.Channel >= 0 && frame.Channels != nil {
+				d.Audio = frame.Channels[score.Channel]
+			}
+			// mono sources carry no channels to locate the speaker with
+			if s.cfg.Array != nil && frame.Channels != nil {
+				if azimuth, err := s.cfg.Array.Azimuth(frame.Channels, audio.SampleRate); err != nil {
+					s.errors.publish(fmt.Errorf("failed to locate %s: %w", d.Wakeword, err))
+				} else {
+					d.Azimuth = &azimuth
+				}
+			}
+			if s.cfg.Clips.Dir != "" {
+				d.Clip = s.cfg.Clips.clipPath(d)
+				clips.Add(1)
+				go func() {
+					defer clips.Done()
+					s.recordClip(d, frame.End)
+				}()
+			}
+			s.detections.publish(d)
 		}
-		fmt.Printf("Confidence: %f %s\n", confidence, detected)
 	}
 	return nil
 }
+
+// detect scores the window on the channels chosen by the channel mode, scores of
+// averaged channels report channel -1
+func (s *SnowGirl) detect(frame audio.Frame) ([]hotword.Score, error) {
+	var (
+		samples = frame.Samples
+		channel = -1
+	)
+	switch {
+	case frame.Channels == nil:
+		channel = 0
+	case s.cfg.ChannelMode == SNRChannel:
+		channel = audio.BestSNR(frame.Channels)
+		samples = frame.Channels[channel]
+	case s.cfg.ChannelMode == BestChannel:
+		var vectors = make([][]float32, len(frame.Channels))
+		for c, samples := range frame.Channels {
+			normalized, err := s.logMelSpec.AudioToVector(samples)
+			if err != nil {
+				return nil, fmt.Errorf("logMelSpec.AudioToVector: %w", err)
+			}
+			vectors[c] = normalized
+		}
+		scores, err := s.detector.DetectChannels(frame.Time, vectors)
+		if err != nil {
+			return nil, fmt.Errorf("detector.DetectChannels: %w", err)
+		}
+		return scores, nil
+	}
+	normalized, err := s.logMelSpec.AudioToVector(samples)
+	if err != nil {
+		return nil, fmt.Errorf("logMelSpec.AudioToVector: %w", err)
+	}
+	scores, err := s.detector.Detect(frame.Time, normalized)
+	if err != nil {
+		return nil, fmt.Errorf("detector.Detect: %w", err)
+	}
+	for i := range scores {
+		scores[i].Channel = channel
+	}
+	return scores, nil
+}